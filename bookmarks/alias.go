@@ -0,0 +1,96 @@
+package bookmarks
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxAliasDepth is the longest alias chain that is followed.
+const maxAliasDepth = 8
+
+// AliasError reports an alias chain that does not end at a bookmark.
+type AliasError struct {
+	Name   string
+	Reason string
+}
+
+func (e AliasError) Error() string {
+	return fmt.Sprintf("alias %s: %s", e.Name, e.Reason)
+}
+
+// IsAlias reports whether b refers to another bookmark instead of a URL.
+func (b *Bookmark) IsAlias() bool {
+	return b.Alias != ""
+}
+
+// resolve follows the alias chain starting at b and returns the bookmark it
+// ends at, b itself if it is not an alias.
+func resolve(b *Bookmark) (*Bookmark, error) {
+	seen := map[string]bool{b.Name: true}
+	for depth := 0; b.IsAlias(); depth++ {
+		if depth == maxAliasDepth {
+			return nil, AliasError{b.Name, fmt.Sprintf("chain longer than %d", maxAliasDepth)}
+		}
+		next, ok := nameIndex[b.Alias]
+		if !ok {
+			return nil, AliasError{b.Name, b.Alias + " does not exist"}
+		}
+		if seen[next.Name] {
+			return nil, AliasError{b.Name, "cycle through " + next.Name}
+		}
+		seen[next.Name] = true
+		b = next
+	}
+	return b, nil
+}
+
+// checkAlias verifies that name may point at target: target must exist and
+// following it must neither lead back to name nor exceed maxAliasDepth.
+func checkAlias(name, target string) error {
+	for depth := 1; ; depth++ {
+		if target == name {
+			return FieldError{"alias", "alias would form a cycle"}
+		}
+		if depth > maxAliasDepth {
+			return FieldError{"alias", fmt.Sprintf("alias chain longer than %d", maxAliasDepth)}
+		}
+		b, ok := nameIndex[target]
+		if !ok {
+			return FieldError{"alias", target + " does not exist"}
+		}
+		if !b.IsAlias() {
+			return nil
+		}
+		target = b.Alias
+	}
+}
+
+// aliasesOf returns the aliases leading to name, directly or through other
+// aliases, sorted by name.
+func (d db) aliasesOf(name string) []*Bookmark {
+	r := make([]*Bookmark, 0)
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		target := queue[0]
+		queue = queue[1:]
+		for _, b := range d {
+			if b.Alias == target && !seen[b.Name] {
+				seen[b.Name] = true
+				r = append(r, b)
+				queue = append(queue, b.Name)
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Name < r[j].Name })
+	return r
+}
+
+// retarget points the aliases of from at to, e.g. after a rename or merge.
+func (d db) retarget(from, to string) {
+	for _, b := range d {
+		if b.Alias == from {
+			b.Alias = to
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package bookmarks
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CanonRules selects the normalisations applied to URLs before they are
+// indexed and compared.
+type CanonRules struct {
+	LowerHost        bool
+	StripTracking    bool
+	DropDefaultPort  bool
+	TrimSlash        bool
+	DecodeIDN        bool
+	RejectDuplicates bool
+	// TrackingParams lists query parameters dropped by StripTracking. Entries
+	// ending in '*' match by prefix.
+	TrackingParams []string
+}
+
+// DefaultCanonRules enables every normalisation and only warns about
+// duplicate URLs.
+func DefaultCanonRules() CanonRules {
+	return CanonRules{
+		LowerHost:       true,
+		StripTracking:   true,
+		DropDefaultPort: true,
+		TrimSlash:       true,
+		DecodeIDN:       true,
+		TrackingParams: []string{
+			"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid",
+			"igshid", "yclid", "_hsenc", "_hsmi", "ref_src",
+		},
+	}
+}
+
+// ParseCanonRules builds rules from a comma separated list of rule names:
+// host, tracking, port, slash, idn and reject. An empty spec yields the
+// defaults.
+func ParseCanonRules(spec string) (CanonRules, error) {
+	r := DefaultCanonRules()
+	if strings.TrimSpace(spec) == "" {
+		return r, nil
+	}
+	r.LowerHost, r.StripTracking, r.DropDefaultPort, r.TrimSlash, r.DecodeIDN = false, false, false, false, false
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "host":
+			r.LowerHost = true
+		case "tracking":
+			r.StripTracking = true
+		case "port":
+			r.DropDefaultPort = true
+		case "slash":
+			r.TrimSlash = true
+		case "idn":
+			r.DecodeIDN = true
+		case "reject":
+			r.RejectDuplicates = true
+		default:
+			return r, errors.New(name + ": unknown canonicalisation rule")
+		}
+	}
+	return r, nil
+}
+
+var canonRules = DefaultCanonRules()
+
+// SetCanonRules replaces the canonicalisation rules. Indices must be rebuilt
+// afterwards, so call it before loading the collection.
+func SetCanonRules(r CanonRules) {
+	canonRules = r
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// Canonical returns the normalised form of raw used as urlIndex key. URLs
+// that fail to parse are returned unchanged.
+func Canonical(raw string) string {
+	return canonRules.Canonical(raw)
+}
+
+// Canonical returns the normalised form of raw under rules c.
+func (c CanonRules) Canonical(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	if c.LowerHost {
+		host = strings.ToLower(host)
+	}
+	if c.DecodeIDN {
+		host = decodeIDN(host)
+	}
+	if c.DropDefaultPort && port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	if c.StripTracking && u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if c.tracking(k) {
+				q.Del(k)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	if c.TrimSlash {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String()
+}
+
+func (c CanonRules) tracking(param string) bool {
+	param = strings.ToLower(param)
+	for _, p := range c.TrackingParams {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(param, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeIDN converts punycode labels (xn--) of host to unicode.
+func decodeIDN(host string) string {
+	labels := strings.Split(host, ".")
+	for i, l := range labels {
+		if !strings.HasPrefix(strings.ToLower(l), "xn--") {
+			continue
+		}
+		if s, err := punycodeDecode(l[4:]); err == nil {
+			labels[i] = s
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// punycodeDecode implements the decoding procedure of RFC 3492.
+func punycodeDecode(s string) (string, error) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	errInvalid := errors.New(s + ": invalid punycode")
+	var output []rune
+	if i := strings.LastIndex(s, "-"); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= 0x80 {
+				return "", errInvalid
+			}
+			output = append(output, r)
+		}
+		s = s[i+1:]
+	}
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+	n, bias, i := initialN, initialBias, 0
+	for pos := 0; pos < len(s); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(s) {
+				return "", errInvalid
+			}
+			c := s[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			default:
+				return "", errInvalid
+			}
+			i += digit * w
+			if i < 0 {
+				return "", errInvalid
+			}
+			t := k - bias
+			if t < tmin {
+				t = tmin
+			} else if t > tmax {
+				t = tmax
+			}
+			if digit < t {
+				break
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		if n > 0x10ffff {
+			return "", errInvalid
+		}
+		i %= len(output) + 1
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
+
+// Duplicates groups bookmarks whose URLs share the same canonical form into
+// the clusters Merge would fold, oldest entry first. Aliases and links with
+// a password or click limit are never merged, nor are entries that cannot be
+// folded into the oldest one, see mergeable. Only groups with more than one
+// entry are returned.
+func (d db) Duplicates() [][]*Bookmark {
+	groups := make(map[string][]*Bookmark)
+	for _, b := range d {
+		if b.IsAlias() || b.Protected || b.ClicksLeft != nil {
+			continue
+		}
+		key := Canonical(b.URL)
+		groups[key] = append(groups[key], b)
+	}
+	r := make([][]*Bookmark, 0)
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return g[i].Created < g[j].Created })
+		cluster := g[:1]
+		for _, b := range g[1:] {
+			if mergeable(g[0], b) {
+				cluster = append(cluster, b)
+			}
+		}
+		if len(cluster) > 1 {
+			r = append(r, cluster)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i][0].Name < r[j][0].Name })
+	return r
+}
+
+// strictness orders visibility levels from public to private.
+var strictness = map[string]int{
+	VisibilityPublic:   0,
+	VisibilityUnlisted: 1,
+	VisibilityPrivate:  2,
+}
+
+// mergeable reports whether b can be folded into keep without losing what
+// sets it apart: b must be no more private than keep, so its tags and notes
+// are not exposed, must not be an alias, have a password or a click limit,
+// and must not point an environment elsewhere than keep does.
+func mergeable(keep, b *Bookmark) bool {
+	if b.IsAlias() || b.Protected || b.ClicksLeft != nil {
+		return false
+	}
+	if strictness[b.Access()] > strictness[keep.Access()] {
+		return false
+	}
+	for env, u := range b.Envs {
+		if v, ok := keep.Envs[env]; ok && v != u {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge folds a cluster of duplicates into its oldest entry: tags are
+// combined, views summed, missing titles, notes, fields and environments
+// taken over and the remaining entries deleted. Entries that are not
+// mergeable into the oldest one are left alone.
+func (d *db) Merge(cluster []*Bookmark) *Bookmark {
+	if len(cluster) == 0 {
+		return nil
+	}
+	keep := cluster[0]
+	for _, b := range cluster[1:] {
+		if b.Created < keep.Created {
+			keep = b
+		}
+	}
+	merged := []*Bookmark{keep}
+	for _, b := range cluster {
+		if b != keep && mergeable(keep, b) {
+			merged = append(merged, b)
+		}
+	}
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, b := range merged {
+		for _, t := range b.Tags {
+			if !seen[t] {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	keep.Tags = tags
+	for _, b := range merged[1:] {
+		keep.Views += b.Views
+		if b.Accessed > keep.Accessed {
+			keep.Accessed = b.Accessed
+		}
+		keep.Pinned = keep.Pinned || b.Pinned
+		if keep.Title == "" {
+			keep.Title = b.Title
+		}
+		if b.Notes != "" && b.Notes != keep.Notes {
+			if keep.Notes != "" {
+				keep.Notes += "\n\n"
+			}
+			keep.Notes += b.Notes
+		}
+		for k, v := range b.Fields {
+			if _, ok := keep.Fields[k]; !ok {
+				if keep.Fields == nil {
+					keep.Fields = make(map[string]string)
+				}
+				keep.Fields[k] = v
+			}
+		}
+		for k, v := range b.Envs {
+			if keep.Envs == nil {
+				keep.Envs = make(map[string]string)
+			}
+			keep.Envs[k] = v
+		}
+		d.DeleteBookmark(b.Name)
+		d.retarget(b.Name, keep.Name)
+	}
+	d.rebuildIndex()
+	searchIndex.add(keep)
+	return keep
+}
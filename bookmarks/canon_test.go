@@ -0,0 +1,69 @@
+package bookmarks
+
+import "testing"
+
+func TestPunycodeDecode(t *testing.T) {
+	// samples from RFC 3492 section 7.1 and common host labels
+	tests := []struct {
+		in, want string
+	}{
+		{"egbpdaj6bu4bxfgehfvwxn", "ليهمابتكلموشعربي؟"},
+		{"ihqwcrb4cv8a8dqg056pqjye", "他们为什么不说中文"},
+		{"3B-ww4c5e180e575a65lsy2b", "3年B組金八先生"},
+		{"-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n", "安室奈美恵-with-SUPER-MONKEYS"},
+		{"MajiKoi5-783gue6qz075azm5e", "MajiでKoiする5秒前"},
+		{"d9juau41awczczp", "そのスピードで"},
+		{"-> $1.00 <--", "-> $1.00 <-"},
+		{"mnchen-3ya", "münchen"},
+		{"bcher-kva", "bücher"},
+		{"MNCHEN-3YA", "MüNCHEN"},
+	}
+	for _, tt := range tests {
+		got, err := punycodeDecode(tt.in)
+		if err != nil {
+			t.Errorf("punycodeDecode(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("punycodeDecode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPunycodeDecodeInvalid(t *testing.T) {
+	for _, in := range []string{
+		"mnchen-3y",
+		"mnchen-3y!",
+		"mü-3ya",
+		"99999999999999",
+	} {
+		if got, err := punycodeDecode(in); err == nil {
+			t.Errorf("punycodeDecode(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestCanonicalIDN(t *testing.T) {
+	// the ACE and unicode spellings of a host share one canonical form
+	tests := []struct {
+		ace, unicode string
+		want         string
+	}{
+		{"https://xn--mnchen-3ya.de/", "https://münchen.de", "https://m%C3%BCnchen.de"},
+		{"https://XN--BCHER-KVA.example:443/a/", "https://bücher.example/a", "https://b%C3%BCcher.example/a"},
+		{"http://www.xn--mnchen-3ya.de:8080/?utm_source=x", "http://www.münchen.de:8080", "http://www.m%C3%BCnchen.de:8080"},
+		{"https://xn--invalid!.example/", "https://xn--invalid!.example", "https://xn--invalid!.example"},
+	}
+	for _, tt := range tests {
+		rules := DefaultCanonRules()
+		for _, raw := range []string{tt.ace, tt.unicode} {
+			got := rules.Canonical(raw)
+			if got != tt.want {
+				t.Errorf("Canonical(%q) = %q, want %q", raw, got, tt.want)
+			}
+			if again := rules.Canonical(got); again != got {
+				t.Errorf("Canonical(%q) = %q, not stable under a second pass", got, again)
+			}
+		}
+	}
+}
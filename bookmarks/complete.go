@@ -0,0 +1,408 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trieTop is the number of best entries cached on every trie node. Lookups
+// rank these candidates only, so prefixes shared by many entries stay fast.
+const trieTop = 32
+
+// Kinds of completions.
+const (
+	KindName = "name"
+	KindTag  = "tag"
+)
+
+// Completion is a type-ahead suggestion.
+type Completion struct {
+	Kind  string
+	Value string
+	URL   string `json:",omitempty"`
+	Score float64
+}
+
+type trieEntry struct {
+	term  string
+	value string
+	// bookmark is set for name entries; tag entries are scored from tagUses
+	bookmark *Bookmark
+	// rank orders the entries for the caches, see frecencyRank
+	rank float64
+	// open marks name entries anonymous clients may list
+	open bool
+}
+
+// trieNode keeps the number of entries below it and caches of up to trieTop
+// of the best ranked ones, among all entries and among the open ones.
+type trieNode struct {
+	children  map[rune]*trieNode
+	entries   []*trieEntry
+	count     int
+	top       []*trieEntry
+	openCount int
+	openTop   []*trieEntry
+}
+
+// trie is a prefix tree over lowercase terms. Ranks do not decay with time,
+// so the caches stay right as long as entries are re-ranked when visited.
+type trie struct {
+	root  *trieNode
+	score func(*trieEntry) float64
+	rank  func(*trieEntry) float64
+	open  func(*trieEntry) bool
+}
+
+var nameTrie = newTrie(nameScore, nameRank, nameOpen)
+var tagTrie = newTrie(tagScore, tagRank, nil)
+
+func newTrie(score, rank func(*trieEntry) float64, open func(*trieEntry) bool) *trie {
+	return &trie{root: &trieNode{}, score: score, rank: rank, open: open}
+}
+
+// nameScore scores names by the frecency of their bookmark.
+func nameScore(e *trieEntry) float64 {
+	return e.bookmark.Frecency(time.Now().Unix())
+}
+
+func nameRank(e *trieEntry) float64 {
+	return frecencyRank(e.bookmark.Views, lastUsed(e.bookmark))
+}
+
+// nameOpen reports whether anonymous clients may list the bookmark of e.
+func nameOpen(e *trieEntry) bool {
+	return public(e.bookmark)
+}
+
+// tagUse holds the combined visits of the bookmarks with a tag and the most
+// recent visit of any of them.
+type tagUse struct {
+	views int32
+	last  int64
+}
+
+// tagUses keeps the use of every tag of tagIndex. It is updated along with
+// tagIndex and on every visit, so ranking a tag does not walk its bookmarks.
+var tagUses = make(map[string]tagUse)
+
+// addTagUse counts the visits of b towards the use of tag t.
+func addTagUse(t string, b *Bookmark) {
+	u := tagUses[t]
+	u.views += b.Views
+	if l := lastUsed(b); l > u.last {
+		u.last = l
+	}
+	tagUses[t] = u
+}
+
+// recountTagUse recomputes the use of tag t from tagIndex, for when one of its
+// bookmarks is dropped and the most recent visit may go with it.
+func recountTagUse(t string) {
+	delete(tagUses, t)
+	for _, b := range tagIndex[t] {
+		addTagUse(t, b)
+	}
+}
+
+// tagScore scores tags by the frecency of their combined use.
+func tagScore(e *trieEntry) float64 {
+	u := tagUses[e.value]
+	return frecency(u.views, u.last, time.Now().Unix())
+}
+
+func tagRank(e *trieEntry) float64 {
+	u := tagUses[e.value]
+	return frecencyRank(u.views, u.last)
+}
+
+// path returns the nodes from the root to term, creating them if create is
+// set. It returns nil if term is not in the trie and create is not set.
+func (t *trie) path(term string, create bool) []*trieNode {
+	n := t.root
+	nodes := []*trieNode{n}
+	for _, r := range term {
+		c, ok := n.children[r]
+		if !ok {
+			if !create {
+				return nil
+			}
+			if n.children == nil {
+				n.children = make(map[rune]*trieNode)
+			}
+			c = &trieNode{}
+			n.children[r] = c
+		}
+		n = c
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// offer adds e to the cache top if it has room or e outranks its worst entry.
+func offer(top []*trieEntry, e *trieEntry) []*trieEntry {
+	if len(top) < trieTop {
+		return append(top, e)
+	}
+	worst := 0
+	for i, c := range top {
+		if c.rank < top[worst].rank {
+			worst = i
+		}
+	}
+	if e.rank > top[worst].rank {
+		top[worst] = e
+	}
+	return top
+}
+
+// without returns top without e, and whether e was in it.
+func without(top []*trieEntry, e *trieEntry) ([]*trieEntry, bool) {
+	for i, c := range top {
+		if c == e {
+			return append(top[:i], top[i+1:]...), true
+		}
+	}
+	return top, false
+}
+
+func (t *trie) insert(value string, b *Bookmark) {
+	e := &trieEntry{term: strings.ToLower(value), value: value, bookmark: b}
+	nodes := t.path(e.term, true)
+	leaf := nodes[len(nodes)-1]
+	leaf.entries = append(leaf.entries, e)
+	e.rank = t.rank(e)
+	e.open = t.open != nil && t.open(e)
+	for _, n := range nodes {
+		n.count++
+		n.top = offer(n.top, e)
+		if e.open {
+			n.openCount++
+			n.openTop = offer(n.openTop, e)
+		}
+	}
+}
+
+// find returns the path to the entry for value, and for names the one
+// pointing at b, along with the entry.
+func (t *trie) find(value string, b *Bookmark) ([]*trieNode, *trieEntry) {
+	nodes := t.path(strings.ToLower(value), false)
+	if nodes == nil {
+		return nil, nil
+	}
+	for _, e := range nodes[len(nodes)-1].entries {
+		if e.value == value && e.bookmark == b {
+			return nodes, e
+		}
+	}
+	return nil, nil
+}
+
+// remove deletes the entry for value, and for names only the one pointing at
+// b, so duplicate names of different bookmarks are kept apart.
+func (t *trie) remove(value string, b *Bookmark) {
+	nodes, e := t.find(value, b)
+	if e == nil {
+		return
+	}
+	leaf := nodes[len(nodes)-1]
+	leaf.entries, _ = without(leaf.entries, e)
+	for _, n := range nodes {
+		var in bool
+		n.count--
+		if n.top, in = without(n.top, e); in && n.count > len(n.top) {
+			t.refill(n)
+		}
+		if e.open {
+			n.openCount--
+			if n.openTop, in = without(n.openTop, e); in && n.openCount > len(n.openTop) {
+				t.refillOpen(n)
+			}
+		}
+	}
+	// prune the branch if it became empty
+	runes := []rune(e.term)
+	for i := len(nodes) - 1; i > 0; i-- {
+		if nodes[i].count > 0 {
+			break
+		}
+		delete(nodes[i-1].children, runes[i-1])
+	}
+}
+
+// touch re-ranks the entry for value, and for names the one pointing at b,
+// after a visit or a change of the bookmarks it is ranked by.
+func (t *trie) touch(value string, b *Bookmark) {
+	nodes, e := t.find(value, b)
+	if e == nil {
+		return
+	}
+	old := e.rank
+	e.rank = t.rank(e)
+	for _, n := range nodes {
+		var in bool
+		if n.top, in = without(n.top, e); !in || e.rank >= old || n.count == len(n.top)+1 {
+			n.top = offer(n.top, e)
+		} else {
+			// an entry ranked lower may have been overtaken by uncached ones
+			t.refill(n)
+		}
+		if !e.open {
+			continue
+		}
+		if n.openTop, in = without(n.openTop, e); !in || e.rank >= old || n.openCount == len(n.openTop)+1 {
+			n.openTop = offer(n.openTop, e)
+		} else {
+			t.refillOpen(n)
+		}
+	}
+}
+
+// refill recomputes the cached best entries of n from its subtree.
+func (t *trie) refill(n *trieNode) {
+	n.top = best(n.collect(nil), trieTop)
+}
+
+// refillOpen recomputes the cached best open entries of n from its subtree.
+func (t *trie) refillOpen(n *trieNode) {
+	all := n.collect(nil)
+	open := all[:0]
+	for _, e := range all {
+		if e.open {
+			open = append(open, e)
+		}
+	}
+	n.openTop = best(open, trieTop)
+}
+
+// best returns the limit best ranked of entries, best first, reordering
+// entries.
+func best(entries []*trieEntry, limit int) []*trieEntry {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].rank > entries[j].rank })
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+func (n *trieNode) collect(dst []*trieEntry) []*trieEntry {
+	dst = append(dst, n.entries...)
+	for _, c := range n.children {
+		dst = c.collect(dst)
+	}
+	return dst
+}
+
+// complete returns up to limit, at most trieTop, of the best ranked entries
+// starting with prefix that keep accepts, best first. With open, only open
+// entries are considered. The cached best entries answer most lookups; only
+// when keep rejects too many of them is the whole subtree searched.
+func (t *trie) complete(prefix string, limit int, open bool, keep func(*trieEntry) bool) []*trieEntry {
+	nodes := t.path(strings.ToLower(prefix), false)
+	if nodes == nil {
+		return nil
+	}
+	n := nodes[len(nodes)-1]
+	cached, count := n.top, n.count
+	if open {
+		cached, count = n.openTop, n.openCount
+	}
+	if res := accepted(cached, open, keep); len(res) >= limit || count == len(cached) {
+		return best(res, limit)
+	}
+	return best(accepted(n.collect(nil), open, keep), limit)
+}
+
+// accepted returns the entries keep accepts, only open ones with open.
+func accepted(entries []*trieEntry, open bool, keep func(*trieEntry) bool) []*trieEntry {
+	res := make([]*trieEntry, 0, len(entries))
+	for _, e := range entries {
+		if (!open || e.open) && keep(e) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// rebuildTries indexes every name and tag of d from scratch.
+func (d db) rebuildTries() {
+	nameTrie = newTrie(nameScore, nameRank, nameOpen)
+	tagTrie = newTrie(tagScore, tagRank, nil)
+	for _, b := range d {
+		nameTrie.insert(b.Name, b)
+	}
+	for t := range tagIndex {
+		tagTrie.insert(t, nil)
+	}
+}
+
+// complete answers /api/v1/complete?prefix=&kind=name|tag|all&limit=. Results
+// are ordered by frecency unless sort=name is given.
+func (app *application) complete(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = "all"
+	}
+	if kind != KindName && kind != KindTag && kind != "all" {
+		badRequest(w, FieldError{"kind", kind + " is not one of name, tag, all"})
+		return
+	}
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			badRequest(w, FieldError{"limit", l + " is not a positive number"})
+			return
+		}
+		limit = n
+	}
+	if limit > trieTop {
+		limit = trieTop
+	}
+	order := r.URL.Query().Get("sort")
+	if order != "" && order != SortFrecency && order != "name" {
+		badRequest(w, FieldError{"sort", order + " is not one of frecency, name"})
+		return
+	}
+	results := make([]Completion, 0)
+	expired := includeExpired(r)
+	// anonymous clients only ever see open names, which have a cache of
+	// their own
+	open := !app.authenticated(r)
+	if kind != KindTag {
+		// names on virtual hosts are completed within the host's namespace
+		ns := app.namespace(r)
+		keep := func(e *trieEntry) bool {
+			return app.listed(r, e.bookmark) && live(e.bookmark, expired)
+		}
+		for _, e := range nameTrie.complete(qualify(ns, prefix), limit, open, keep) {
+			name, _ := unqualify(ns, e.value)
+			results = append(results, Completion{KindName, name, e.bookmark.URL, nameTrie.score(e)})
+		}
+	}
+	if kind != KindName {
+		keep := func(e *trieEntry) bool {
+			return len(app.listable(r, visible(tagIndex[e.value], expired))) > 0
+		}
+		for _, e := range tagTrie.complete(prefix, limit, false, keep) {
+			results = append(results, Completion{KindTag, e.value, "", tagTrie.score(e)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if order != "name" && results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Value < results[j].Value
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		app.errorLog.Printf("encoding error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,179 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testToken = "secret"
+
+// testApp returns an application serving d, whose indices are rebuilt.
+func testApp(d db) *application {
+	d.rebuildIndex()
+	app := NewApp(log.New(io.Discard, "", 0), log.New(io.Discard, "", 0), &d)
+	app.RequireToken(testToken)
+	return app
+}
+
+// testCollection returns n bookmarks named b0, b1, ..., tagged by their last
+// digit, every tenth one public.
+func testCollection(n int) db {
+	d := NewDB()
+	for i := 0; i < n; i++ {
+		b := NewBookmark(fmt.Sprintf("b%d", i), fmt.Sprintf("https://example.com/%d", i), []string{fmt.Sprintf("t%d", i%10)})
+		b.Views = int32(i % 97)
+		if i%10 == 0 {
+			b.Visibility = VisibilityPublic
+		}
+		d = append(d, b)
+	}
+	return d
+}
+
+func completeNames(app *application, prefix string, auth bool) []string {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/complete?kind=name&limit=5&prefix="+prefix, nil)
+	if auth {
+		r.Header.Set("Authorization", "Bearer "+testToken)
+	}
+	w := httptest.NewRecorder()
+	app.complete(w, r)
+	var res []Completion
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		panic(err)
+	}
+	names := make([]string, len(res))
+	for i, c := range res {
+		names[i] = c.Value
+	}
+	return names
+}
+
+func TestCompleteRanking(t *testing.T) {
+	app := testApp(testCollection(1000))
+	// b999 has no views; visits must bring it into the cached best entries
+	for i := 0; i < 200; i++ {
+		nameIndex["b999"].Update()
+	}
+	tests := []struct {
+		prefix string
+		auth   bool
+		first  string
+		count  int
+	}{
+		{"b", true, "b999", 5},
+		{"b99", true, "b999", 5},
+		{"b9", false, "b90", 5},
+		{"b99", false, "b990", 1},
+		{"x", true, "", 0},
+	}
+	for _, tt := range tests {
+		got := completeNames(app, tt.prefix, tt.auth)
+		if len(got) != tt.count {
+			t.Errorf("complete(%q, auth=%t) = %v, want %d results", tt.prefix, tt.auth, got, tt.count)
+			continue
+		}
+		if tt.count > 0 && got[0] != tt.first {
+			t.Errorf("complete(%q, auth=%t) = %v, want %s first", tt.prefix, tt.auth, got, tt.first)
+		}
+		for _, name := range got {
+			if !tt.auth && !public(nameIndex[name]) {
+				t.Errorf("complete(%q) offered %s to an anonymous client", tt.prefix, name)
+			}
+		}
+	}
+}
+
+func BenchmarkComplete(b *testing.B) {
+	app := testApp(testCollection(100000))
+	for _, bm := range []struct {
+		name   string
+		prefix string
+		auth   bool
+	}{
+		{"owner/short", "b", true},
+		{"owner/long", "b1234", true},
+		{"anonymous/short", "b", false},
+		{"anonymous/long", "b1234", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/complete?prefix="+bm.prefix, nil)
+		if bm.auth {
+			r.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				app.complete(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
+
+func TestTagUse(t *testing.T) {
+	inTempDir(t)
+	app := testApp(testCollection(100))
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/tags/t1", nil)
+		r.Header.Set("Authorization", "Bearer "+testToken)
+		app.getBookmarkByTag(httptest.NewRecorder(), r)
+	}
+	nameIndex["b2"].Update()
+	if err := app.db.DeleteBookmark("b13"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.db.Add(NewBookmark("new", "https://example.com/new", []string{"t1", "fresh"})); err != nil {
+		t.Fatal(err)
+	}
+	// the running totals must match a count from scratch
+	var first string
+	var top float64
+	for tag, list := range tagIndex {
+		var want tagUse
+		for _, b := range list {
+			want.views += b.Views
+			if l := lastUsed(b); l > want.last {
+				want.last = l
+			}
+		}
+		if got := tagUses[tag]; got != want {
+			t.Errorf("use of %s = %+v, want %+v", tag, got, want)
+		}
+		if r := frecencyRank(want.views, want.last); r > top {
+			first, top = tag, r
+		}
+	}
+	if len(tagUses) != len(tagIndex) {
+		t.Errorf("%d tags in use, want %d", len(tagUses), len(tagIndex))
+	}
+	if got := completeTags(app, ""); len(got) == 0 || got[0] != first {
+		t.Errorf("complete() = %v, want %s first", got, first)
+	}
+}
+
+func completeTags(app *application, prefix string) []string {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/complete?kind=tag&prefix="+prefix, nil)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	app.complete(w, r)
+	var res []Completion
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		panic(err)
+	}
+	tags := make([]string, len(res))
+	for i, c := range res {
+		tags[i] = c.Value
+	}
+	return tags
+}
+
+func BenchmarkTagListing(b *testing.B) {
+	app := testApp(testCollection(10000))
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/tags/t1", nil)
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	for i := 0; i < b.N; i++ {
+		app.getBookmarkByTag(httptest.NewRecorder(), r)
+	}
+}
@@ -0,0 +1,108 @@
+package bookmarks
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A bookmark may hold a URL per environment, e.g. for dev, staging and prod.
+// The environment is picked by the env query parameter, the X-Env header or
+// the env cookie, in that order; the URL of the bookmark is the default.
+// An environment asked for in the query must exist, while the header and
+// cookie, which apply to every link, fall back to the default.
+const (
+	envPrefix = "env."
+	envParam  = "env"
+	envHeader = "X-Env"
+	envCookie = "env"
+)
+
+var envRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// envValues collects the env.<name> parameters of v.
+func envValues(v url.Values) map[string]string {
+	r := make(map[string]string)
+	for k := range v {
+		if strings.HasPrefix(k, envPrefix) {
+			r[strings.TrimPrefix(k, envPrefix)] = strings.TrimSpace(v.Get(k))
+		}
+	}
+	return r
+}
+
+// validateEnvs checks the environment names and URLs of a bookmark.
+func validateEnvs(envs map[string]string) error {
+	var errs ValidationError
+	names := make([]string, 0, len(envs))
+	for name := range envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := envPrefix + name
+		if !envRe.MatchString(name) {
+			errs.add(field, FieldError{field, "environment names are up to 32 lowercase letters, digits, '_' and '-'"})
+			continue
+		}
+		if err := ValidateURL(envs[name]); err != nil {
+			errs.add(field, FieldError{field, err.(FieldError).Message})
+		}
+	}
+	return errs.err()
+}
+
+// EnvNames returns the environments b has a URL for, sorted.
+func (b *Bookmark) EnvNames() []string {
+	r := make([]string, 0, len(b.Envs))
+	for name := range b.Envs {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// requestEnv returns the environment r asks for and whether it was asked
+// for in the query.
+func requestEnv(r *http.Request) (string, bool) {
+	if env := r.URL.Query().Get(envParam); env != "" {
+		return env, true
+	}
+	if env := r.Header.Get(envHeader); env != "" {
+		return env, false
+	}
+	if c, err := r.Cookie(envCookie); err == nil && c.Value != "" {
+		return c.Value, false
+	}
+	return "", false
+}
+
+// envURL returns the URL of b for the environment r asks for.
+func envURL(r *http.Request, b *Bookmark) (string, error) {
+	env, strict := requestEnv(r)
+	if u, ok := b.Envs[env]; ok {
+		return u, nil
+	}
+	if strict && len(b.Envs) > 0 {
+		return "", FieldError{envParam, fmt.Sprintf("no url for env %s, have %s", env, strings.Join(b.EnvNames(), ", "))}
+	}
+	return b.URL, nil
+}
+
+// expandFor returns the URL b leads to for r: the URL of the environment r
+// asks for, expanded with args and the rest of the query. Bookmarks without
+// environments leave the env parameter to their template.
+func expandFor(r *http.Request, b *Bookmark, args []string) (string, error) {
+	tmpl, err := envURL(r, b)
+	if err != nil {
+		return "", err
+	}
+	query := r.URL.Query()
+	if len(b.Envs) > 0 {
+		query.Del(envParam)
+	}
+	return Expand(tmpl, args, query)
+}
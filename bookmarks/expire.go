@@ -0,0 +1,72 @@
+package bookmarks
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expired reports whether the bookmark has passed its expiry time, or was
+// already archived by the sweeper.
+func (b *Bookmark) Expired(now int64) bool {
+	if b.Archived {
+		return true
+	}
+	return b.Expires != 0 && b.Expires <= now
+}
+
+// ParseTTL parses a lifetime such as "7d", "12h" or "90m". In addition to the
+// units understood by time.ParseDuration, a "d" suffix denotes days.
+func ParseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 {
+			return 0, errors.New(s + ": invalid ttl")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New(s + ": invalid ttl")
+	}
+	return d, nil
+}
+
+// parseExpiry converts the expires and ttl form values of a request into an
+// absolute unix timestamp. expires may be a unix timestamp or RFC3339 time.
+func parseExpiry(expires, ttl string, now time.Time) (int64, error) {
+	if expires != "" {
+		if ts, err := strconv.ParseInt(expires, 10, 64); err == nil {
+			return ts, nil
+		}
+		t, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return 0, errors.New(expires + ": invalid expiry time")
+		}
+		return t.Unix(), nil
+	}
+	if ttl != "" {
+		d, err := ParseTTL(ttl)
+		if err != nil {
+			return 0, err
+		}
+		return now.Add(d).Unix(), nil
+	}
+	return 0, nil
+}
+
+// Sweep archives every bookmark whose expiry time has passed and returns the
+// number of entries archived.
+func (d db) Sweep(now int64) int {
+	n := 0
+	for _, b := range d {
+		if !b.Archived && b.Expired(now) {
+			b.Archived = true
+			b.Status = StatusArchived
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,199 @@
+package bookmarks
+
+import (
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits on the name_re and url_re patterns. Go regexps run in linear time,
+// so only the size of the compiled program needs bounding.
+const (
+	maxRegexLength = 256
+	maxRegexInsts  = 4096
+)
+
+// listFilter holds the status, pinned, custom field, date, view count and
+// regex constraints of a list request.
+type listFilter struct {
+	status string
+	pinned *bool
+	fields map[string]string
+	// unix time bounds; after is inclusive, before exclusive, zero is unset
+	createdAfter, createdBefore   int64
+	accessedAfter, accessedBefore int64
+	viewsMin, viewsMax            *int64
+	nameRe, urlRe                 *regexp.Regexp
+}
+
+// parseTimeBound reads a time as a unix timestamp, a YYYY-MM-DD date, an
+// RFC3339 time, or relative to now as -7d, -12h and so on.
+func parseTimeBound(param, s string, now time.Time) (int64, error) {
+	if strings.HasPrefix(s, "-") {
+		if d, err := ParseTTL(s[1:]); err == nil {
+			return now.Add(-d).Unix(), nil
+		}
+	}
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ts, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, FieldError{param, s + " is not a time (unix, YYYY-MM-DD, RFC3339 or -7d)"}
+}
+
+// compileRegex compiles s, rejecting patterns too large to match cheaply.
+func compileRegex(param, s string) (*regexp.Regexp, error) {
+	if len(s) > maxRegexLength {
+		return nil, FieldError{param, "pattern longer than " + strconv.Itoa(maxRegexLength) + " bytes"}
+	}
+	re, err := syntax.Parse(s, syntax.Perl)
+	if err != nil {
+		return nil, FieldError{param, err.Error()}
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil || len(prog.Inst) > maxRegexInsts {
+		return nil, FieldError{param, "pattern too complex"}
+	}
+	return regexp.Compile(s)
+}
+
+// parseListFilter reads the status, pinned, field.<name>, created_after,
+// created_before, accessed_after, accessed_before, views_min, views_max,
+// name_re and url_re query parameters.
+// Field values are normalized against schema so they compare equal to the
+// stored ones.
+func parseListFilter(q url.Values, schema Schema) (listFilter, error) {
+	var f listFilter
+	if s := q.Get("status"); s != "" {
+		if !ValidStatus(s) {
+			return f, FieldError{"status", s + " is not a valid status"}
+		}
+		f.status = s
+	}
+	if p := q.Get("pinned"); p != "" {
+		v, err := strconv.ParseBool(p)
+		if err != nil {
+			return f, FieldError{"pinned", p + " is not a boolean"}
+		}
+		f.pinned = &v
+	}
+	now := time.Now()
+	times := []struct {
+		param string
+		bound *int64
+	}{
+		{"created_after", &f.createdAfter},
+		{"created_before", &f.createdBefore},
+		{"accessed_after", &f.accessedAfter},
+		{"accessed_before", &f.accessedBefore},
+	}
+	for _, t := range times {
+		if s := q.Get(t.param); s != "" {
+			ts, err := parseTimeBound(t.param, s, now)
+			if err != nil {
+				return f, err
+			}
+			*t.bound = ts
+		}
+	}
+	views := []struct {
+		param string
+		bound **int64
+	}{
+		{"views_min", &f.viewsMin},
+		{"views_max", &f.viewsMax},
+	}
+	for _, v := range views {
+		if s := q.Get(v.param); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				return f, FieldError{v.param, s + " is not a view count"}
+			}
+			*v.bound = &n
+		}
+	}
+	patterns := []struct {
+		param string
+		re    **regexp.Regexp
+	}{
+		{"name_re", &f.nameRe},
+		{"url_re", &f.urlRe},
+	}
+	for _, p := range patterns {
+		if s := q.Get(p.param); s != "" {
+			re, err := compileRegex(p.param, s)
+			if err != nil {
+				return f, err
+			}
+			*p.re = re
+		}
+	}
+	fields, err := schema.Validate(fieldValues(q), false)
+	if err != nil {
+		return f, err
+	}
+	if len(fields) > 0 {
+		f.fields = fields
+	}
+	return f, nil
+}
+
+func (f listFilter) empty() bool {
+	return f.status == "" && f.pinned == nil && f.fields == nil &&
+		f.createdAfter == 0 && f.createdBefore == 0 &&
+		f.accessedAfter == 0 && f.accessedBefore == 0 &&
+		f.viewsMin == nil && f.viewsMax == nil && f.nameRe == nil && f.urlRe == nil
+}
+
+// within reports whether ts lies in [after, before), ignoring unset bounds.
+func within(ts, after, before int64) bool {
+	return (after == 0 || ts >= after) && (before == 0 || ts < before)
+}
+
+func (f listFilter) match(b *Bookmark) bool {
+	if f.status != "" && b.State() != f.status {
+		return false
+	}
+	if f.pinned != nil && b.Pinned != *f.pinned {
+		return false
+	}
+	for k, v := range f.fields {
+		if b.Fields[k] != v {
+			return false
+		}
+	}
+	if !within(b.Created, f.createdAfter, f.createdBefore) || !within(b.Accessed, f.accessedAfter, f.accessedBefore) {
+		return false
+	}
+	if (f.viewsMin != nil && int64(b.Views) < *f.viewsMin) || (f.viewsMax != nil && int64(b.Views) > *f.viewsMax) {
+		return false
+	}
+	if f.nameRe != nil && !f.nameRe.MatchString(b.Name) {
+		return false
+	}
+	if f.urlRe != nil && !f.urlRe.MatchString(b.URL) {
+		return false
+	}
+	return true
+}
+
+func (f listFilter) apply(list []*Bookmark) []*Bookmark {
+	if f.empty() {
+		return list
+	}
+	r := make([]*Bookmark, 0, len(list))
+	for _, b := range list {
+		if f.match(b) {
+			r = append(r, b)
+		}
+	}
+	return r
+}
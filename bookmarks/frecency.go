@@ -0,0 +1,42 @@
+package bookmarks
+
+import (
+	"math"
+	"time"
+)
+
+// frecencyHalfLife is the time after which the weight of past visits halves.
+const frecencyHalfLife = 14 * 24 * time.Hour
+
+// SortFrecency orders results by Frecency, highest first.
+const SortFrecency = "frecency"
+
+// frecency weighs the number of visits by how recently the last one
+// happened, decaying exponentially with frecencyHalfLife.
+func frecency(views int32, last, now int64) float64 {
+	age := float64(now - last)
+	if age < 0 {
+		age = 0
+	}
+	return float64(1+views) * math.Exp2(-age/frecencyHalfLife.Seconds())
+}
+
+// frecencyRank orders entries as frecency does at any one time, but does not
+// change as time passes: it is log2 of frecency plus now/frecencyHalfLife.
+// Rankings kept by it therefore only change when an entry is visited.
+func frecencyRank(views int32, last int64) float64 {
+	return math.Log2(float64(1+views)) + float64(last)/frecencyHalfLife.Seconds()
+}
+
+// lastUsed returns when b was last visited, or created if never.
+func lastUsed(b *Bookmark) int64 {
+	if b.Accessed > b.Created {
+		return b.Accessed
+	}
+	return b.Created
+}
+
+// Frecency scores b by access frequency and recency at time now.
+func (b *Bookmark) Frecency(now int64) float64 {
+	return frecency(b.Views, lastUsed(b), now)
+}
@@ -0,0 +1,169 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minFuzzyScore is the similarity below which a name is not considered a
+// plausible match.
+const minFuzzyScore = 0.5
+
+// maxSuggestions caps the "did you mean" list returned with a 404.
+const maxSuggestions = 5
+
+// Suggestion is a bookmark name similar to a name that was looked up.
+type Suggestion struct {
+	Name  string
+	Score float64
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// nameTokens splits a bookmark name on its separators.
+func nameTokens(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	})
+}
+
+// tokenOverlap is the Jaccard similarity of the name tokens of a and b.
+func tokenOverlap(a, b string) float64 {
+	ta, tb := nameTokens(a), nameTokens(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(ta))
+	for _, t := range ta {
+		set[t] = true
+	}
+	common := 0
+	union := len(set)
+	seen := make(map[string]bool, len(tb))
+	for _, t := range tb {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if set[t] {
+			common++
+		} else {
+			union++
+		}
+	}
+	return float64(common) / float64(union)
+}
+
+// similarity scores how close candidate is to query, between 0 and 1.
+func similarity(query, candidate string) float64 {
+	q, c := strings.ToLower(query), strings.ToLower(candidate)
+	if q == c {
+		return 1
+	}
+	longest := len([]rune(q))
+	if n := len([]rune(c)); n > longest {
+		longest = n
+	}
+	edit := 1 - float64(levenshtein(q, c))/float64(longest)
+	score := edit
+	if o := tokenOverlap(q, c); o > score {
+		score = o
+	}
+	if strings.HasPrefix(c, q) || strings.HasPrefix(q, c) {
+		score += 0.1
+	}
+	if score > 1 {
+		score = 1
+	}
+	return score
+}
+
+// suggest ranks the names accepted by keep by their similarity to name.
+func suggest(name string, keep func(*Bookmark) bool) []Suggestion {
+	r := make([]Suggestion, 0)
+	for n, b := range nameIndex {
+		if !keep(b) {
+			continue
+		}
+		if s := similarity(name, n); s >= minFuzzyScore {
+			r = append(r, Suggestion{Name: n, Score: s})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		return r[i].Name < r[j].Name
+	})
+	return r
+}
+
+// fuzzyFind answers find?name=&fuzzy=1 with approximate matches, best first.
+func (app *application) fuzzyFind(w http.ResponseWriter, r *http.Request, name string, filter listFilter) {
+	expired := includeExpired(r)
+	limit := 10
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	results := make([]SearchResult, 0)
+	for _, s := range suggest(name, func(b *Bookmark) bool {
+		return app.listed(r, b) && live(b, expired) && filter.match(b)
+	}) {
+		if len(results) == limit {
+			break
+		}
+		results = append(results, SearchResult{Bookmark: nameIndex[s.Name], Score: s.Score})
+	}
+	if len(results) == 0 {
+		app.notFound(w, r, name)
+		return
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+// notFound answers a missed name lookup with the closest names r may see.
+func (app *application) notFound(w http.ResponseWriter, r *http.Request, name string) {
+	expired := includeExpired(r)
+	suggestions := suggest(name, func(b *Bookmark) bool {
+		return app.listed(r, b) && live(b, expired)
+	})
+	names := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(struct {
+		Error       string   `json:"error"`
+		Suggestions []string `json:"suggestions"`
+	}{name + ": not found", names})
+}
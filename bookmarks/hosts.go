@@ -0,0 +1,154 @@
+package bookmarks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Virtual hosts give each host name the server answers to a namespace of
+// go-links of its own, so that go/wiki and docs/wiki can lead to different
+// places. Bookmarks in a namespace are named namespace/name; the default
+// namespace is empty and its names carry no prefix. On a virtual host,
+// go-links are served at /{name} as well as /go/{name}, and names are looked
+// up in the namespace of the host.
+
+// Hosts maps lowercase host names, without port, to namespaces.
+type Hosts map[string]string
+
+// ParseHosts builds hosts from a comma separated list of host=namespace
+// pairs, e.g. "go=,docs=docs,l.example.com=links". An empty namespace maps
+// the host to the default one.
+func ParseHosts(spec string) (Hosts, error) {
+	h := make(Hosts)
+	if strings.TrimSpace(spec) == "" {
+		return h, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New(pair + ": expected host=namespace")
+		}
+		host, ns := strings.ToLower(kv[0]), kv[1]
+		if ns != "" && !nameRe.MatchString(ns) {
+			return nil, errors.New(ns + ": namespaces must start with a letter or digit and contain only letters, digits, '.', '_' and '-'")
+		}
+		if reserved(ns) {
+			return nil, errors.New(ns + ": namespace is reserved for the API")
+		}
+		h[host] = ns
+	}
+	return h, nil
+}
+
+// namespaces holds the namespaces served by some virtual host, the only ones
+// bookmark names may be qualified with.
+var namespaces = make(map[string]bool)
+
+// SetHosts sets the virtual hosts the server answers to. Call it before
+// loading the collection.
+func (app *application) SetHosts(h Hosts) {
+	app.hosts = h
+	namespaces = make(map[string]bool)
+	for _, ns := range h {
+		if ns != "" {
+			namespaces[ns] = true
+		}
+	}
+}
+
+// virtualHost returns the namespace of the host r was addressed to, and
+// whether that host is a virtual host.
+func (app *application) virtualHost(r *http.Request) (string, bool) {
+	ns, ok := app.hosts[hostName(r.Host)]
+	return ns, ok
+}
+
+// hostName returns host lowercased and without port.
+func hostName(host string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// namespace returns the namespace go-links are looked up in for r.
+func (app *application) namespace(r *http.Request) string {
+	ns, _ := app.virtualHost(r)
+	return ns
+}
+
+// isNamespace reports whether some virtual host serves the namespace ns.
+func (app *application) isNamespace(ns string) bool {
+	return namespaces[ns]
+}
+
+// goPrefix returns the path go-links are served under for r: the root on
+// virtual hosts, prefix elsewhere.
+func (app *application) goPrefix(r *http.Request, prefix string) string {
+	if _, ok := app.virtualHost(r); ok {
+		return "/"
+	}
+	return prefix
+}
+
+// qualify returns the full name of name in the namespace ns.
+func qualify(ns, name string) string {
+	if ns == "" {
+		return name
+	}
+	return ns + "/" + name
+}
+
+// unqualify returns name without the namespace ns, and whether name is in
+// that namespace.
+func unqualify(ns, name string) (string, bool) {
+	if ns == "" {
+		return name, !strings.Contains(name, "/")
+	}
+	return strings.TrimPrefix(name, ns+"/"), strings.HasPrefix(name, ns+"/")
+}
+
+// inNamespace reports whether b belongs to the namespace ns.
+func inNamespace(ns string, b *Bookmark) bool {
+	_, in := unqualify(ns, b.Name)
+	return in
+}
+
+// goLink returns the go-link of b as seen from r: relative to the host's
+// namespace on virtual hosts, and /go/ns/name for namespaced bookmarks
+// elsewhere.
+func (app *application) goLink(r *http.Request, b *Bookmark) string {
+	name, ok := unqualify(app.namespace(r), b.Name)
+	if !ok {
+		name = b.Name
+	}
+	return origin(r) + app.goPrefix(r, "/go/") + name
+}
+
+// goName splits the path of a go-link requested by r into the full name of
+// the bookmark and its arguments. Outside virtual hosts, ns/name reaches a
+// bookmark of the namespace ns unless ns is itself a bookmark.
+func (app *application) goName(r *http.Request, path string) (string, []string) {
+	name, args := splitGoPath(path)
+	ns := app.namespace(r)
+	if ns == "" && len(args) > 0 && app.isNamespace(name) {
+		if _, ok := nameIndex[name]; !ok {
+			return qualify(name, args[0]), args[1:]
+		}
+	}
+	return qualify(ns, name), args
+}
+
+// root serves the listing at /, limited to the host's namespace on virtual
+// hosts, and go-links at /{name} on virtual hosts, where /?q= is the target
+// of browser searches.
+func (app *application) root(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.virtualHost(r); ok && (r.URL.Path != "/" || strings.TrimSpace(r.URL.Query().Get("q")) != "") {
+		app.redirect("/")(w, r)
+		return
+	}
+	app.home(w, r)
+}
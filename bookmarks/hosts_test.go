@@ -0,0 +1,35 @@
+package bookmarks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVirtualHostRoot(t *testing.T) {
+	wiki := NewBookmark("docs/wiki", "https://wiki.example.com", []string{"t"})
+	wiki.Visibility = VisibilityPublic
+	app := testApp(nil)
+	app.SetHosts(Hosts{"docs": "docs"})
+	t.Cleanup(func() { namespaces = make(map[string]bool) })
+	if err := app.db.Add(wiki); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{"http://docs/", http.StatusOK, ""},
+		{"http://docs/?q=wiki", http.StatusFound, "/wiki"},
+		{"http://docs/?q=+", http.StatusOK, ""},
+		{"http://docs/wiki", http.StatusFound, "https://wiki.example.com"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.Routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.target, w.Code, w.Header().Get("Location"), tt.code, tt.location)
+		}
+	}
+}
@@ -15,10 +15,39 @@ type Bookmark struct {
 	Created  int64
 	Accessed int64
 	Views    int32
+	Title    string `json:",omitempty"`
+	Notes    string `json:",omitempty"`
+	// Expires is the unix time after which the bookmark is considered stale.
+	// Zero means the bookmark never expires.
+	Expires  int64  `json:",omitempty"`
+	Archived bool   `json:",omitempty"`
+	Status   string `json:",omitempty"`
+	Pinned   bool   `json:",omitempty"`
+	// Visibility is one of private, unlisted or public; empty means private.
+	Visibility string `json:",omitempty"`
+	// Fields holds values of the custom fields defined by the collection schema.
+	Fields map[string]string `json:",omitempty"`
+	// Alias names the bookmark this one stands for; aliases have no URL.
+	Alias string `json:",omitempty"`
+	// Creator is who added the bookmark, as given by the client.
+	Creator string `json:",omitempty"`
+	// Protected bookmarks redirect only after their password is given.
+	Protected bool `json:",omitempty"`
+	// Password is the hash of the password, stored apart from the dump.
+	Password string `json:"-"`
+	// Envs maps environment names to the URL used there instead of URL.
+	Envs map[string]string `json:",omitempty"`
+	// ClicksLeft counts down the redirects left before the link is used
+	// up; nil means unlimited.
+	ClicksLeft *int32 `json:",omitempty"`
 }
 
 func (b Bookmark) String() string {
-	return fmt.Sprintf("%s | %s | %s | Views: %d", b.Name, b.URL, strings.Join(b.Tags, ","), b.Views)
+	url := b.URL
+	if b.Alias != "" {
+		url = "-> " + b.Alias
+	}
+	return fmt.Sprintf("%s | %s | %s | Views: %d", b.Name, url, strings.Join(b.Tags, ","), b.Views)
 }
 
 type db []*Bookmark
@@ -31,8 +60,9 @@ func NewDB() db {
 	return make([]*Bookmark, 0)
 }
 
+// FindURL looks up a bookmark by the canonical form of url.
 func (d db) FindURL(url string) *Bookmark {
-	if b, ok := urlIndex[url]; ok {
+	if b, ok := urlIndex[Canonical(url)]; ok {
 		return b
 	}
 	return nil
@@ -67,13 +97,18 @@ func (d *db) rebuildIndex() {
 	urlIndex = make(map[string]*Bookmark)
 	nameIndex = make(map[string]*Bookmark)
 	tagIndex = make(map[string][]*Bookmark)
+	tagUses = make(map[string]tagUse)
 	for _, b := range *d {
 		nameIndex[b.Name] = b
-		urlIndex[b.URL] = b
+		if key := Canonical(b.URL); !b.IsAlias() && urlIndex[key] == nil {
+			urlIndex[key] = b
+		}
 		for _, t := range b.Tags {
 			tagIndex[t] = append(tagIndex[t], b)
+			addTagUse(t, b)
 		}
 	}
+	d.rebuildTries()
 }
 
 func (d *db) DeleteBookmark(name string) error {
@@ -84,11 +119,17 @@ func (d *db) DeleteBookmark(name string) error {
 	(*d)[i] = (*d)[0]
 	*d = (*d)[1:]
 	delete(nameIndex, b.Name)
-	delete(urlIndex, b.URL)
+	nameTrie.remove(b.Name, b)
+	searchIndex.remove(b)
+	if key := Canonical(b.URL); urlIndex[key] == b {
+		delete(urlIndex, key)
+	}
 	for _, t := range b.Tags {
 		b := tagIndex[t]
 		if len(b) == 1 {
 			delete(tagIndex, t)
+			delete(tagUses, t)
+			tagTrie.remove(t, nil)
 			continue
 		}
 		for i, entry := range b {
@@ -97,6 +138,8 @@ func (d *db) DeleteBookmark(name string) error {
 				tagIndex[t] = tagIndex[t][1:]
 			}
 		}
+		recountTagUse(t)
+		tagTrie.touch(t, nil)
 	}
 	return nil
 }
@@ -122,18 +165,41 @@ func (d *db) Add(b *Bookmark) error {
 	if _, found := d.Find(b.Name); found != nil {
 		return errors.New("[SKIP] entry " + b.Name + " already exists.")
 	}
+	if dup := d.FindURL(b.URL); dup != nil && canonRules.RejectDuplicates {
+		return errors.New("[SKIP] " + b.URL + " duplicates entry " + dup.Name)
+	}
 	*d = append(*d, b)
 	for _, tag := range b.Tags {
+		_, ok := tagIndex[tag]
 		tagIndex[tag] = append(tagIndex[tag], b)
+		addTagUse(tag, b)
+		if ok {
+			tagTrie.touch(tag, nil)
+		} else {
+			tagTrie.insert(tag, nil)
+		}
+	}
+	if key := Canonical(b.URL); !b.IsAlias() && urlIndex[key] == nil {
+		urlIndex[key] = b
 	}
-	urlIndex[b.URL] = b
 	nameIndex[b.Name] = b
+	nameTrie.insert(b.Name, b)
+	searchIndex.add(b)
 	return nil
 }
 
 func (b *Bookmark) Update() error {
 	b.Views++
 	b.Accessed = time.Now().Unix()
+	// the visit moves b up in the completion rankings
+	nameTrie.touch(b.Name, b)
+	for _, t := range b.Tags {
+		u := tagUses[t]
+		u.views++
+		u.last = b.Accessed
+		tagUses[t] = u
+		tagTrie.touch(t, nil)
+	}
 	return nil
 }
 
@@ -142,11 +208,13 @@ func NewBookmark(name, url string, tags []string) *Bookmark {
 	t := make([]string, len(tags))
 	copy(t, tags)
 	return &Bookmark{
-		Name:     name,
-		URL:      url,
-		Tags:     t,
-		Created:  time.Now().Unix(),
-		Accessed: 0,
-		Views:    0,
+		Name:       name,
+		URL:        url,
+		Tags:       t,
+		Created:    time.Now().Unix(),
+		Accessed:   0,
+		Views:      0,
+		Status:     StatusUnread,
+		Visibility: VisibilityPrivate,
 	}
 }
@@ -0,0 +1,145 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxOpenSearchSuggestions is the number of suggestions offered to browsers,
+// which show only a handful anyway.
+const maxOpenSearchSuggestions = 8
+
+// openSearchDescription lets browsers add the go-links as a search engine, so
+// that "go foo" typed in the address bar opens /go/foo.
+var openSearchDescription = template.Must(template.New("opensearch").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/" xmlns:moz="http://www.mozilla.org/2006/browser/search/">
+<ShortName>go</ShortName>
+<Description>go-links on {{.Host}}</Description>
+<InputEncoding>UTF-8</InputEncoding>
+<Url type="text/html" method="get" template="{{.Base}}?q={searchTerms}"/>
+<Url type="application/x-suggestions+json" method="get" template="{{.Origin}}/api/v1/suggest?q={searchTerms}"/>
+<moz:SearchForm>{{.Base}}</moz:SearchForm>
+</OpenSearchDescription>
+`))
+
+// origin returns the scheme and host r was addressed to.
+func origin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// openSearch returns a handler serving the OpenSearch description for the
+// go-links under prefix, or the root of a virtual host.
+func (app *application) openSearch(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			Host   string
+			Origin string
+			Base   string
+		}{r.Host, origin(r), origin(r) + app.goPrefix(r, prefix)}
+		// the XML is escaped by hand since text/template knows no XML context
+		for _, s := range []*string{&data.Host, &data.Origin, &data.Base} {
+			*s = template.HTMLEscapeString(*s)
+		}
+		w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+		if err := openSearchDescription.Execute(w, data); err != nil {
+			app.errorLog.Printf("rendering error: %s\n", err.Error())
+		}
+	}
+}
+
+// searchPath turns a search typed into the browser, such as "jira OPS-123",
+// into the go-link path "jira/OPS-123".
+func searchPath(q string) string {
+	words := strings.Fields(q)
+	for i, w := range words {
+		words[i] = url.PathEscape(w)
+	}
+	return strings.Join(words, "/")
+}
+
+// openSearchSuggest returns a handler answering /api/v1/suggest?q= for the
+// go-links under prefix, in the OpenSearch suggestions format:
+//
+//	["q", ["completion", ...], ["description", ...], ["url", ...]]
+//
+// The first word of q is completed to bookmark names starting with it,
+// followed by bookmarks carrying a tag that starts with it. Any further words
+// are kept as arguments of the go-link. On virtual hosts only the bookmarks
+// of the host's namespace are suggested.
+func (app *application) openSearchSuggest(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		words := strings.Fields(q)
+		completions := make([]string, 0)
+		descriptions := make([]string, 0)
+		urls := make([]string, 0)
+		if len(words) > 0 && len(words[0]) <= MaxNameLength {
+			ns := app.namespace(r)
+			term, rest := strings.ToLower(words[0]), words[1:]
+			var matches []*Bookmark
+			seen := make(map[*Bookmark]bool)
+			ok := func(b *Bookmark) bool {
+				return !seen[b] && inNamespace(ns, b) && app.listed(r, b) && live(b, false)
+			}
+			open := !app.authenticated(r)
+			names := nameTrie.complete(qualify(ns, term), maxOpenSearchSuggestions, open, func(e *trieEntry) bool {
+				return ok(e.bookmark)
+			})
+			for _, e := range names {
+				seen[e.bookmark] = true
+				matches = append(matches, e.bookmark)
+			}
+			var tagged []*Bookmark
+			tags := tagTrie.complete(term, maxOpenSearchSuggestions, false, func(e *trieEntry) bool {
+				for _, b := range tagIndex[e.value] {
+					if ok(b) {
+						return true
+					}
+				}
+				return false
+			})
+			for _, e := range tags {
+				for _, b := range tagIndex[e.value] {
+					if ok(b) {
+						seen[b] = true
+						tagged = append(tagged, b)
+					}
+				}
+			}
+			now := time.Now().Unix()
+			sort.SliceStable(tagged, func(i, j int) bool {
+				return tagged[i].Frecency(now) > tagged[j].Frecency(now)
+			})
+			matches = append(matches, tagged...)
+			if len(matches) > maxOpenSearchSuggestions {
+				matches = matches[:maxOpenSearchSuggestions]
+			}
+			for _, b := range matches {
+				name, _ := unqualify(ns, b.Name)
+				completion := strings.Join(append([]string{name}, rest...), " ")
+				description := b.Title
+				if description == "" {
+					description = strings.Join(b.Tags, ", ")
+				}
+				completions = append(completions, completion)
+				descriptions = append(descriptions, description)
+				urls = append(urls, origin(r)+app.goPrefix(r, prefix)+searchPath(completion))
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-suggestions+json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode([]interface{}{q, completions, descriptions, urls}); err != nil {
+			app.errorLog.Printf("encoding error: %s\n", err.Error())
+		}
+	}
+}
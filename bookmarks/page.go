@@ -0,0 +1,235 @@
+package bookmarks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort orders accepted by list endpoints. Prefixing one with "-" reverses
+// it, except frecency which always lists the highest scores first.
+const (
+	SortName     = "name"
+	SortCreated  = "created"
+	SortAccessed = "accessed"
+	SortViews    = "views"
+)
+
+// Page sizes of list endpoints.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// nextCursorHeader carries the cursor of the following page, if any.
+const nextCursorHeader = "X-Next-Cursor"
+
+// sortKey returns the value b is ordered by for key. Frecency is kept in log
+// form, log2(1+views) + last/halfLife, which orders like Frecency but does not
+// change with time, so cursors stay valid.
+func sortKey(b *Bookmark, key string) float64 {
+	switch key {
+	case SortCreated:
+		return float64(b.Created)
+	case SortAccessed:
+		return float64(b.Accessed)
+	case SortViews:
+		return float64(b.Views)
+	case SortFrecency:
+		return math.Log2(float64(1+b.Views)) + float64(lastUsed(b))/frecencyHalfLife.Seconds()
+	}
+	return 0
+}
+
+// order is a parsed sort parameter.
+type order struct {
+	key  string
+	desc bool
+}
+
+func parseOrder(s string) (order, error) {
+	o := order{key: strings.TrimPrefix(s, "-"), desc: strings.HasPrefix(s, "-")}
+	switch o.key {
+	case "", SortName, SortCreated, SortAccessed, SortViews:
+	case SortFrecency:
+		o.desc = true
+	default:
+		return o, FieldError{"sort", s + " is not one of name, created, accessed, views, frecency"}
+	}
+	return o, nil
+}
+
+// compare orders a before b (-1), after b (1) or alike (0). Ties are broken
+// by name, which is unique.
+func (o order) compare(ak float64, an string, bk float64, bn string) int {
+	c := 0
+	switch {
+	case ak < bk:
+		c = -1
+	case ak > bk:
+		c = 1
+	case an < bn:
+		c = -1
+	case an > bn:
+		c = 1
+	}
+	if o.desc {
+		c = -c
+	}
+	return c
+}
+
+func (o order) less(a, b *Bookmark) bool {
+	return o.compare(sortKey(a, o.key), a.Name, sortKey(b, o.key), b.Name) < 0
+}
+
+// cursor marks the last bookmark of a page, so the next one starts after it
+// even if bookmarks were added or removed in between.
+type cursor struct {
+	Sort string
+	Key  float64
+	Name string
+}
+
+func (c cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(s string) (*cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return nil, FieldError{"cursor", "malformed cursor"}
+	}
+	return &c, nil
+}
+
+// bookmarkFields maps the lowercased field names of Bookmark to their names.
+// Fields left out of the JSON form, such as the password hash, are left out.
+var bookmarkFields = func() map[string]string {
+	r := make(map[string]string)
+	t := reflect.TypeOf(Bookmark{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("json") == "-" {
+			continue
+		}
+		r[strings.ToLower(t.Field(i).Name)] = t.Field(i).Name
+	}
+	return r
+}()
+
+// page holds the sort, limit, cursor and fields parameters of a list request.
+type page struct {
+	sort   string
+	order  order
+	limit  int
+	cursor *cursor
+	fields []string
+}
+
+// parsePage reads the pagination parameters of q. Every invalid parameter is
+// reported in the returned ValidationError.
+func parsePage(q url.Values) (page, error) {
+	var errs ValidationError
+	p := page{sort: q.Get("sort")}
+	var err error
+	p.order, err = parseOrder(p.sort)
+	errs.add("sort", err)
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			errs.add("limit", FieldError{"limit", l + " is not a positive number"})
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		p.limit = n
+	}
+	if c := q.Get("cursor"); c != "" {
+		p.cursor, err = parseCursor(c)
+		errs.add("cursor", err)
+		if p.cursor != nil && p.cursor.Sort != p.sort {
+			errs.add("cursor", FieldError{"cursor", "cursor belongs to a different sort order"})
+		}
+		if p.limit == 0 {
+			p.limit = defaultPageSize
+		}
+	}
+	if f := q.Get("fields"); f != "" {
+		for _, name := range strings.Split(f, ",") {
+			field, ok := bookmarkFields[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				errs.add("fields", FieldError{"fields", name + " is not a bookmark field"})
+				continue
+			}
+			p.fields = append(p.fields, field)
+		}
+	}
+	// pages need a stable order
+	if p.limit > 0 && p.order.key == "" {
+		p.order.key = SortName
+	}
+	if len(errs) > 0 {
+		return p, errs
+	}
+	return p, nil
+}
+
+// apply sorts list and cuts out the requested page. It returns the cursor
+// of the following page, or "" if this is the last one.
+func (p page) apply(list []*Bookmark) ([]*Bookmark, string) {
+	if p.order.key == "" {
+		return list, ""
+	}
+	r := make([]*Bookmark, len(list))
+	copy(r, list)
+	sort.SliceStable(r, func(i, j int) bool { return p.order.less(r[i], r[j]) })
+	if p.cursor != nil {
+		c := p.cursor
+		r = r[sort.Search(len(r), func(i int) bool {
+			return p.order.compare(sortKey(r[i], p.order.key), r[i].Name, c.Key, c.Name) > 0
+		}):]
+	}
+	if p.limit == 0 || len(r) <= p.limit {
+		return r, ""
+	}
+	r = r[:p.limit]
+	last := r[len(r)-1]
+	return r, cursor{p.sort, sortKey(last, p.order.key), last.Name}.String()
+}
+
+// project keeps only the selected fields of every bookmark of list.
+func (p page) project(list []*Bookmark) interface{} {
+	if len(p.fields) == 0 {
+		return list
+	}
+	r := make([]map[string]interface{}, 0, len(list))
+	for _, b := range list {
+		v := reflect.ValueOf(b).Elem()
+		m := make(map[string]interface{}, len(p.fields))
+		for _, f := range p.fields {
+			m[f] = v.FieldByName(f).Interface()
+		}
+		r = append(r, m)
+	}
+	return r
+}
+
+// write encodes list as page p, announcing the next page in the
+// X-Next-Cursor header.
+func (p page) write(w http.ResponseWriter, list []*Bookmark, next string) error {
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+	return json.NewEncoder(w).Encode(p.project(list))
+}
@@ -0,0 +1,30 @@
+package bookmarks
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParsePageFields(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   []string
+		ok     bool
+	}{
+		{"name,url", []string{"Name", "URL"}, true},
+		{" Name , TAGS", []string{"Name", "Tags"}, true},
+		{"name,password", nil, false},
+		{"name,color", nil, false},
+	}
+	for _, tt := range tests {
+		p, err := parsePage(url.Values{"fields": {tt.fields}})
+		if (err == nil) != tt.ok {
+			t.Errorf("parsePage(fields=%q) error = %v, want ok=%t", tt.fields, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(p.fields, tt.want) {
+			t.Errorf("parsePage(fields=%q) = %v, want %v", tt.fields, p.fields, tt.want)
+		}
+	}
+}
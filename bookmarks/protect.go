@@ -0,0 +1,319 @@
+package bookmarks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const passwordFile = "db.passwords"
+
+// Passwords are hashed with PBKDF2-HMAC-SHA256 and stored as
+// pbkdf2-sha256$<iterations>$<salt>$<key>.
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 100000
+	passwordSaltLength = 16
+	MinPasswordLength  = 8
+	MaxPasswordLength  = 256
+)
+
+// Failed password attempts are counted per client and link, and per link
+// across all clients; either running out blocks further attempts until
+// attemptWindow has passed since the first failure.
+const (
+	maxClientAttempts = 5
+	maxLinkAttempts   = 50
+	attemptWindow     = 15 * time.Minute
+)
+
+// pbkdf2 derives a key of keyLen bytes from password and salt (RFC 8018).
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			u = sum(prf, u)
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+func sum(h hash.Hash, b []byte) []byte {
+	h.Reset()
+	h.Write(b)
+	return h.Sum(nil)
+}
+
+// hashPassword returns the salted hash of password.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2([]byte(password), salt, passwordIterations, sha256.Size)
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches the hash made by
+// hashPassword. Malformed hashes match nothing.
+func checkPassword(hashed, password string) bool {
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	key, err := enc.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(pbkdf2([]byte(password), salt, iterations, len(key)), key) == 1
+}
+
+// SetPassword protects the bookmark with password, or removes the
+// protection if password is empty.
+func (b *Bookmark) SetPassword(password string) error {
+	if password == "" {
+		b.Password, b.Protected = "", false
+		return nil
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return FieldError{"password", fmt.Sprintf("must be between %d and %d characters", MinPasswordLength, MaxPasswordLength)}
+	}
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	b.Password, b.Protected = hashed, true
+	return nil
+}
+
+// parseMaxClicks parses the max_clicks parameter; zero means no limit.
+func parseMaxClicks(v string) (*int32, error) {
+	n, err := strconv.ParseInt(v, 10, 32)
+	if err != nil || n < 0 {
+		return nil, FieldError{"max_clicks", v + " is not a non-negative number"}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	left := int32(n)
+	return &left, nil
+}
+
+// clickMu serialises taking clicks so a limited link is not followed more
+// often than allowed.
+var clickMu sync.Mutex
+
+// usedUp reports whether b has no redirects left.
+func (b *Bookmark) usedUp() bool {
+	clickMu.Lock()
+	defer clickMu.Unlock()
+	return b.ClicksLeft != nil && *b.ClicksLeft <= 0
+}
+
+// takeClick uses up one redirect of b, reporting false if none is left.
+func (b *Bookmark) takeClick() bool {
+	clickMu.Lock()
+	defer clickMu.Unlock()
+	if b.ClicksLeft == nil {
+		return true
+	}
+	if *b.ClicksLeft <= 0 {
+		return false
+	}
+	left := *b.ClicksLeft - 1
+	b.ClicksLeft = &left
+	return true
+}
+
+// failures counts failed attempts since the first one.
+type failures struct {
+	count int
+	since time.Time
+}
+
+// limiter counts failed password attempts by key.
+type limiter struct {
+	sync.Mutex
+	failures map[string]*failures
+}
+
+func newLimiter() *limiter {
+	return &limiter{failures: make(map[string]*failures)}
+}
+
+// wait returns how long key is blocked after max failures, or zero.
+func (l *limiter) wait(key string, max int, now time.Time) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.since) >= attemptWindow {
+		return 0
+	}
+	if f.count < max {
+		return 0
+	}
+	return f.since.Add(attemptWindow).Sub(now)
+}
+
+// fail counts a failed attempt for each of keys, dropping counts whose
+// window has passed.
+func (l *limiter) fail(now time.Time, keys ...string) {
+	l.Lock()
+	defer l.Unlock()
+	for k, f := range l.failures {
+		if now.Sub(f.since) >= attemptWindow {
+			delete(l.failures, k)
+		}
+	}
+	for _, key := range keys {
+		f, ok := l.failures[key]
+		if !ok {
+			f = &failures{since: now}
+			l.failures[key] = f
+		}
+		f.count++
+	}
+}
+
+func (l *limiter) reset(key string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.failures, key)
+}
+
+// clientIP returns the address r came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// passwordPage asks for the password of a protected link.
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}: password required</title></head>
+<body>
+<h1>{{.Name}} is password protected</h1>
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}{{if not .Blocked}}<form method="post">
+<p><label>Password <input type="password" name="password" required autofocus></label></p>
+<p><button type="submit">Continue</button></p>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// unlock checks the password posted for the protected bookmark b, reached
+// by name, and renders the password page unless it matches.
+func (app *application) unlock(w http.ResponseWriter, r *http.Request, name string, b *Bookmark) bool {
+	now := time.Now()
+	client := b.Name + " " + clientIP(r)
+	data := struct {
+		Name    string
+		Error   string
+		Blocked bool
+	}{Name: name}
+	status := http.StatusUnauthorized
+	wait := app.attempts.wait(client, maxClientAttempts, now)
+	if link := app.attempts.wait(b.Name, maxLinkAttempts, now); link > wait {
+		wait = link
+	}
+	switch {
+	case wait > 0:
+		secs := int(wait/time.Second) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		data.Error = fmt.Sprintf("Too many failed attempts, try again in %d minutes.", (secs+59)/60)
+		data.Blocked = true
+		status = http.StatusTooManyRequests
+	case r.Method != http.MethodPost:
+	case checkPassword(b.Password, r.PostFormValue("password")):
+		app.attempts.reset(client)
+		return true
+	default:
+		app.attempts.fail(now, client, b.Name)
+		app.infoLog.Printf("wrong password for %s from %s\n", b.Name, clientIP(r))
+		data.Error = "Wrong password."
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := passwordPage.Execute(w, data); err != nil {
+		app.errorLog.Printf("rendering error: %s\n", err.Error())
+	}
+	return false
+}
+
+// loadPasswords restores the password hashes, which are kept out of the
+// bookmark dump so that listings never carry them.
+func (app *application) loadPasswords() {
+	file, err := os.Open(passwordFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			app.errorLog.Println(err)
+		}
+		return
+	}
+	defer file.Close()
+	hashes := make(map[string]string)
+	if err = json.NewDecoder(file).Decode(&hashes); err != nil {
+		app.errorLog.Println("failed to decode passwords", err)
+		return
+	}
+	for name, hashed := range hashes {
+		if b, ok := nameIndex[name]; ok {
+			b.Password = hashed
+		}
+	}
+}
+
+func (app *application) savePasswords() error {
+	hashes := make(map[string]string)
+	for _, b := range *app.db {
+		if b.Protected {
+			hashes[b.Name] = b.Password
+		}
+	}
+	file, err := os.OpenFile(passwordFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(hashes)
+}
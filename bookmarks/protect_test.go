@@ -0,0 +1,41 @@
+package bookmarks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRemovePassword(t *testing.T) {
+	inTempDir(t)
+	tests := []struct {
+		value     string
+		code      int
+		protected bool
+	}{
+		{"1", http.StatusOK, false},
+		{"true", http.StatusOK, false},
+		{"0", http.StatusOK, true},
+		{"false", http.StatusOK, true},
+		{"maybe", http.StatusBadRequest, true},
+	}
+	for _, tt := range tests {
+		sec := NewBookmark("sec", "https://secret.example.com", []string{"t"})
+		if err := sec.SetPassword("correct horse"); err != nil {
+			t.Fatal(err)
+		}
+		app := testApp(db{sec})
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/sec", strings.NewReader("tags=t,u&remove_password="+tt.value))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		app.Routes().ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("remove_password=%s: status %d, want %d: %s", tt.value, w.Code, tt.code, w.Body.String())
+		}
+		if got := nameIndex["sec"].Protected; got != tt.protected {
+			t.Errorf("remove_password=%s: protected = %t, want %t", tt.value, got, tt.protected)
+		}
+	}
+}
@@ -0,0 +1,634 @@
+package bookmarks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A minimal QR code encoder (ISO/IEC 18004) supporting byte mode, versions 1
+// to 40 and the four error correction levels, enough to encode any URL.
+
+// Error correction levels, in the order of the tables below.
+const (
+	QRLevelL = iota
+	QRLevelM
+	QRLevelQ
+	QRLevelH
+)
+
+// qrLevels maps level names to levels.
+var qrLevels = map[string]int{"L": QRLevelL, "M": QRLevelM, "Q": QRLevelQ, "H": QRLevelH}
+
+// qrFormatLevel is the two bit level indicator of the format information.
+var qrFormatLevel = [4]int{1, 0, 3, 2}
+
+// Error correction codewords per block and number of blocks, per level and
+// version (index 0 unused).
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// ErrQRTooLong is returned for data that does not fit a version 40 code.
+var ErrQRTooLong = errors.New("data too long for a QR code")
+
+// QRCode is a square matrix of modules, true meaning dark.
+type QRCode struct {
+	Size    int
+	modules [][]bool
+	// function marks finder, timing, alignment, format and version modules
+	function [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (q *QRCode) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// qrRawModules is the number of modules of a version available for data and
+// error correction, including remainder bits.
+func qrRawModules(ver int) int {
+	n := (16*ver+128)*ver + 64
+	if ver >= 2 {
+		align := ver/7 + 2
+		n -= (25*align-10)*align - 55
+		if ver >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCodewords is the number of data codewords of a version and level.
+func qrDataCodewords(ver, level int) int {
+	return qrRawModules(ver)/8 - qrECCPerBlock[level][ver]*qrBlocks[level][ver]
+}
+
+// bitBuffer accumulates bits most significant first.
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (v>>uint(i))&1 != 0)
+	}
+}
+
+// EncodeQR encodes data in byte mode at the given level, picking the
+// smallest version it fits and the mask with the lowest penalty.
+func EncodeQR(data []byte, level int) (*QRCode, error) {
+	if level < QRLevelL || level > QRLevelH {
+		return nil, fmt.Errorf("invalid error correction level %d", level)
+	}
+	ver := 1
+	for ; ver <= 40; ver++ {
+		countBits := 8
+		if ver >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrDataCodewords(ver, level)*8 {
+			break
+		}
+	}
+	if ver > 40 {
+		return nil, ErrQRTooLong
+	}
+	var bb bitBuffer
+	bb.append(0x4, 4) // byte mode
+	if ver < 10 {
+		bb.append(len(data), 8)
+	} else {
+		bb.append(len(data), 16)
+	}
+	for _, c := range data {
+		bb.append(int(c), 8)
+	}
+	capacity := qrDataCodewords(ver, level) * 8
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	codewords := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			codewords[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+
+	q := newQRCode(ver)
+	q.drawFunctionPatterns(ver, level)
+	q.drawCodewords(q.addECC(codewords, ver, level))
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(level, mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // masks are their own inverse
+	}
+	q.applyMask(best)
+	q.drawFormatBits(level, best)
+	return q, nil
+}
+
+func newQRCode(ver int) *QRCode {
+	size := ver*4 + 17
+	q := &QRCode{Size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	return q
+}
+
+func (q *QRCode) setFunction(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns(ver, level int) {
+	for i := 0; i < q.Size; i++ {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(q.Size-4, 3)
+	q.drawFinder(3, q.Size-4)
+	pos := qrAlignmentPositions(ver)
+	n := len(pos)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			// the corners taken by finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			q.drawAlignment(pos[i], pos[j])
+		}
+	}
+	q.drawFormatBits(level, 0)
+	q.drawVersion(ver)
+}
+
+func (q *QRCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			d := absInt(dx)
+			if absInt(dy) > d {
+				d = absInt(dy)
+			}
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < q.Size && yy >= 0 && yy < q.Size {
+				q.setFunction(xx, yy, d != 2 && d != 4)
+			}
+		}
+	}
+}
+
+func (q *QRCode) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			d := absInt(dx)
+			if absInt(dy) > d {
+				d = absInt(dy)
+			}
+			q.setFunction(x+dx, y+dy, d != 1)
+		}
+	}
+}
+
+// qrAlignmentPositions returns the row and column centres of the alignment
+// patterns of a version.
+func qrAlignmentPositions(ver int) []int {
+	if ver == 1 {
+		return nil
+	}
+	n := ver/7 + 2
+	step := (ver*8 + n*3 + 5) / (n*4 - 4) * 2
+	r := make([]int, n)
+	r[0] = 6
+	for i, pos := n-1, ver*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		r[i] = pos
+	}
+	return r
+}
+
+// drawFormatBits writes both copies of the level and mask, protected by a
+// BCH(15,5) code.
+func (q *QRCode) drawFormatBits(level, mask int) {
+	data := qrFormatLevel[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.setFunction(q.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, q.Size-15+i, bit(i))
+	}
+	q.setFunction(8, q.Size-8, true)
+}
+
+// drawVersion writes both copies of the version, protected by a BCH(18,6)
+// code, for versions 7 and up.
+func (q *QRCode) drawVersion(ver int) {
+	if ver < 7 {
+		return
+	}
+	rem := ver
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := ver<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := q.Size-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// addECC splits data into blocks, appends the Reed-Solomon error correction
+// codewords of each and interleaves the result.
+func (q *QRCode) addECC(data []byte, ver, level int) []byte {
+	blocks := qrBlocks[level][ver]
+	eccLen := qrECCPerBlock[level][ver]
+	raw := qrRawModules(ver) / 8
+	short := blocks - raw%blocks
+	shortLen := raw / blocks
+	divisor := rsDivisor(eccLen)
+	var all [][]byte
+	k := 0
+	for i := 0; i < blocks; i++ {
+		n := shortLen - eccLen
+		if i >= short {
+			n++
+		}
+		dat := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(dat, divisor)
+		if i < short {
+			dat = append(dat, 0) // placeholder, skipped when interleaving
+		}
+		all = append(all, append(dat, ecc...))
+	}
+	r := make([]byte, 0, raw)
+	for i := range all[0] {
+		for j, b := range all {
+			if i != shortLen-eccLen || j >= short {
+				r = append(r, b[i])
+			}
+		}
+	}
+	return r
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the coefficients of the Reed-Solomon generator
+// polynomial of the given degree, highest first, without the leading 1.
+func rsDivisor(degree int) []byte {
+	r := make([]byte, degree)
+	r[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range r {
+			r[j] = gfMul(r[j], root)
+			if j+1 < len(r) {
+				r[j] ^= r[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return r
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	r := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ r[0]
+		copy(r, r[1:])
+		r[len(r)-1] = 0
+		for i, d := range divisor {
+			r[i] ^= gfMul(d, factor)
+		}
+	}
+	return r
+}
+
+// drawCodewords places data in the zigzag order of the standard, skipping
+// function modules.
+func (q *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan; the mask with the lowest
+// score is used.
+func (q *QRCode) penalty() int {
+	p := 0
+	n := q.Size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finderLike := [2][11]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			// runs of five or more modules of one colour
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+			// patterns resembling a finder
+			for x := 0; x+11 <= n; x++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(x+k, y, transpose) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						p += 40
+					}
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					p += 3
+				}
+			}
+		}
+	}
+	total := n * n
+	k := (absInt(dark*20-total*10)+total-1)/total - 1
+	return p + k*10
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// qrQuietZone is the light border around the code, in modules.
+const qrQuietZone = 4
+
+// scale returns the module size in pixels and the offset of the code that
+// centres it in an image of size pixels.
+func (q *QRCode) scale(size int) (int, int, error) {
+	n := q.Size + 2*qrQuietZone
+	if size < n {
+		return 0, 0, fmt.Errorf("size must be at least %d for this code", n)
+	}
+	s := size / n
+	return s, (size - q.Size*s) / 2, nil
+}
+
+// PNG renders the code as a size by size pixel PNG image.
+func (q *QRCode) PNG(size int) ([]byte, error) {
+	s, off, err := q.scale(size)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for py := 0; py < s; py++ {
+				for px := 0; px < s; px++ {
+					img.SetColorIndex(off+x*s+px, off+y*s+py, 1)
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as an SVG image size pixels wide.
+func (q *QRCode) SVG(size int) ([]byte, error) {
+	if _, _, err := q.scale(size); err != nil {
+		return nil, err
+	}
+	n := q.Size + 2*qrQuietZone
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>` + "\n")
+	return buf.Bytes(), nil
+}
+
+// Sizes of rendered QR codes, in pixels.
+const (
+	defaultQRSize = 256
+	maxQRSize     = 4096
+)
+
+// qr answers /api/v1/qr/{name}.png and .svg with a QR code of the short link
+// of the bookmark, or of its URL with target=url. ec selects the error
+// correction level (L, M, Q or H) and size the width in pixels.
+func (app *application) qr(w http.ResponseWriter, r *http.Request) {
+	file := strings.TrimPrefix(r.URL.Path, "/api/v1/qr/")
+	var name, format string
+	switch {
+	case strings.HasSuffix(file, ".png"):
+		name, format = strings.TrimSuffix(file, ".png"), "png"
+	case strings.HasSuffix(file, ".svg"):
+		name, format = strings.TrimSuffix(file, ".svg"), "svg"
+	default:
+		http.Error(w, "expected /api/v1/qr/{name}.png or .svg", http.StatusNotFound)
+		return
+	}
+	b, ok := nameIndex[name]
+	if !ok || !live(b, false) || !app.resolvable(r, b) {
+		app.notFound(w, r, name)
+		return
+	}
+	var errs ValidationError
+	level := QRLevelM
+	if ec := r.URL.Query().Get("ec"); ec != "" {
+		if level, ok = qrLevels[strings.ToUpper(ec)]; !ok {
+			errs.add("ec", FieldError{"ec", ec + " is not one of L, M, Q, H"})
+		}
+	}
+	size := defaultQRSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxQRSize {
+			errs.add("size", FieldError{"size", fmt.Sprintf("%s is not a size between 1 and %d", s, maxQRSize)})
+		}
+		size = n
+	}
+	content := app.goLink(r, b)
+	switch r.URL.Query().Get("target") {
+	case "", "short":
+	case "url":
+		dest, err := resolve(b)
+		if err == nil && (!live(dest, false) || !app.resolvable(r, dest)) {
+			// the alias may be open while the bookmark it ends at is not
+			app.notFound(w, r, name)
+			return
+		}
+		var target string
+		if err == nil {
+			target, err = envURL(r, dest)
+		}
+		if err != nil {
+			errs.add("target", err)
+		} else if IsTemplate(target) {
+			errs.add("target", FieldError{"target", "templates have no fixed url, use the short link"})
+		} else {
+			content = target
+		}
+	default:
+		errs.add("target", FieldError{"target", "must be short or url"})
+	}
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
+	code, err := EncodeQR([]byte(content), level)
+	if err != nil {
+		badRequest(w, FieldError{"target", err.Error()})
+		return
+	}
+	var img []byte
+	if format == "png" {
+		img, err = code.PNG(size)
+	} else {
+		img, err = code.SVG(size)
+	}
+	if err != nil {
+		badRequest(w, FieldError{"size", err.Error()})
+		return
+	}
+	if format == "png" {
+		w.Header().Set("Content-Type", "image/png")
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	}
+	w.Write(img)
+}
@@ -0,0 +1,267 @@
+package bookmarks
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func module(q *QRCode, x, y int) string {
+	if q.Dark(x, y) {
+		return "1"
+	}
+	return "0"
+}
+
+func TestQRFormatBits(t *testing.T) {
+	// ISO/IEC 18004 table C.1, most significant bit first
+	tests := []struct {
+		level, mask int
+		want        string
+	}{
+		{QRLevelL, 0, "111011111000100"},
+		{QRLevelL, 7, "110100101110110"},
+		{QRLevelM, 0, "101010000010010"},
+		{QRLevelM, 5, "100000011001110"},
+		{QRLevelQ, 0, "011010101011111"},
+		{QRLevelQ, 3, "011101000000110"},
+		{QRLevelH, 0, "001011010001001"},
+		{QRLevelH, 6, "000110100001100"},
+	}
+	for _, tt := range tests {
+		q := newQRCode(1)
+		q.drawFormatBits(tt.level, tt.mask)
+		var first, second strings.Builder
+		for i := 14; i >= 0; i-- {
+			// the copy around the top left finder
+			switch {
+			case i <= 5:
+				first.WriteString(module(q, 8, i))
+			case i == 6:
+				first.WriteString(module(q, 8, 7))
+			case i == 7:
+				first.WriteString(module(q, 8, 8))
+			case i == 8:
+				first.WriteString(module(q, 7, 8))
+			default:
+				first.WriteString(module(q, 14-i, 8))
+			}
+			// the copy split between the other two finders
+			if i < 8 {
+				second.WriteString(module(q, q.Size-1-i, 8))
+			} else {
+				second.WriteString(module(q, 8, q.Size-15+i))
+			}
+		}
+		if first.String() != tt.want || second.String() != tt.want {
+			t.Errorf("format bits of level %d mask %d = %s and %s, want %s",
+				tt.level, tt.mask, first.String(), second.String(), tt.want)
+		}
+	}
+}
+
+func TestQRVersionBits(t *testing.T) {
+	// ISO/IEC 18004 table D.1, most significant bit first
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{7, "000111110010010100"},
+		{8, "001000010110111100"},
+		{21, "010101011010000011"},
+		{40, "101000110001101001"},
+	}
+	for _, tt := range tests {
+		q := newQRCode(tt.version)
+		q.drawVersion(tt.version)
+		var below, right strings.Builder
+		for i := 17; i >= 0; i-- {
+			a, b := q.Size-11+i%3, i/3
+			below.WriteString(module(q, b, a))
+			right.WriteString(module(q, a, b))
+		}
+		if below.String() != tt.want || right.String() != tt.want {
+			t.Errorf("version bits of %d = %s and %s, want %s", tt.version, below.String(), right.String(), tt.want)
+		}
+	}
+}
+
+func TestQRErrorCorrection(t *testing.T) {
+	// data and error correction codewords of version 1-M symbols
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{
+			// ISO/IEC 18004 annex I
+			"01234567",
+			[]byte{16, 32, 12, 86, 97, 128, 236, 17, 236, 17, 236, 17, 236, 17, 236, 17},
+			[]byte{165, 36, 212, 193, 237, 54, 199, 135, 44, 85},
+		},
+		{
+			"HELLO WORLD",
+			[]byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			[]byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.want))); !bytes.Equal(got, tt.want) {
+			t.Errorf("error correction of %s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	// symbols checked with an independent decoder
+	tests := []struct {
+		data  string
+		level int
+		want  []string
+	}{
+		{
+			"https://go.example/wiki", QRLevelM,
+			[]string{
+				"1111111000111000101111111",
+				"1000001001100011001000001",
+				"1011101010000011101011101",
+				"1011101010001100001011101",
+				"1011101011000100101011101",
+				"1000001010010111001000001",
+				"1111111010101010101111111",
+				"0000000010000011000000000",
+				"1011111001000111101111100",
+				"1010110110011010100100010",
+				"0111001000010111110111011",
+				"0111000000101011110100001",
+				"0100111110011110001010111",
+				"1101100110000100100101010",
+				"1011101110011001110111011",
+				"1000100101010011000110001",
+				"1011011010110111111110100",
+				"0000000011101101100011000",
+				"1111111000100100101010111",
+				"1000001011001010100011010",
+				"1011101011001111111110111",
+				"1011101010000101011011111",
+				"1011101010111001100001101",
+				"1000001001010010111111001",
+				"1111111010011000011111111",
+			},
+		},
+		{
+			"go/wiki", QRLevelH,
+			[]string{
+				"111111101101101111111",
+				"100000100100001000001",
+				"101110100011001011101",
+				"101110101111001011101",
+				"101110100111101011101",
+				"100000100101101000001",
+				"111111101010101111111",
+				"000000000110000000000",
+				"001011101010110001001",
+				"101111011110000100111",
+				"011111110011101011011",
+				"000101001000011001001",
+				"001011100010001000011",
+				"000000001101101110111",
+				"111111100001010111011",
+				"100000101100000010001",
+				"101110101100100001011",
+				"101110100100011110010",
+				"101110101011111111001",
+				"100000100011010000010",
+				"111111100100111000011",
+			},
+		},
+	}
+	for _, tt := range tests {
+		q, err := EncodeQR([]byte(tt.data), tt.level)
+		if err != nil {
+			t.Errorf("EncodeQR(%q): %v", tt.data, err)
+			continue
+		}
+		if q.Size != len(tt.want) {
+			t.Errorf("EncodeQR(%q) size = %d, want %d", tt.data, q.Size, len(tt.want))
+			continue
+		}
+		for y, row := range tt.want {
+			var got strings.Builder
+			for x := 0; x < q.Size; x++ {
+				got.WriteString(module(q, x, y))
+			}
+			if got.String() != row {
+				t.Errorf("EncodeQR(%q) row %d = %s, want %s", tt.data, y, got.String(), row)
+			}
+		}
+	}
+}
+
+func TestEncodeQRCapacity(t *testing.T) {
+	// byte mode capacities from ISO/IEC 18004 table 7
+	tests := []struct {
+		length, level int
+		size          int
+		err           error
+	}{
+		{1, QRLevelL, 21, nil},
+		{17, QRLevelL, 21, nil},
+		{18, QRLevelL, 25, nil},
+		{14, QRLevelM, 21, nil},
+		{15, QRLevelM, 25, nil},
+		{7, QRLevelH, 21, nil},
+		{2953, QRLevelL, 177, nil},
+		{2954, QRLevelL, 0, ErrQRTooLong},
+		{1273, QRLevelH, 177, nil},
+		{1274, QRLevelH, 0, ErrQRTooLong},
+	}
+	for _, tt := range tests {
+		q, err := EncodeQR(bytes.Repeat([]byte("a"), tt.length), tt.level)
+		if err != tt.err {
+			t.Errorf("EncodeQR(%d bytes, level %d) error = %v, want %v", tt.length, tt.level, err, tt.err)
+			continue
+		}
+		if err == nil && q.Size != tt.size {
+			t.Errorf("EncodeQR(%d bytes, level %d) size = %d, want %d", tt.length, tt.level, q.Size, tt.size)
+		}
+	}
+}
+
+func TestQRTargetAccess(t *testing.T) {
+	sec := NewBookmark("sec", "https://secret.example.com", []string{"t"})
+	sec.Visibility = VisibilityPublic
+	if err := sec.SetPassword("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	priv := NewBookmark("priv", "https://private.example.com", []string{"t"})
+	pub := NewBookmark("pub", "", []string{"t"})
+	pub.Alias, pub.Visibility = "sec", VisibilityPublic
+	open := NewBookmark("open", "", []string{"t"})
+	open.Alias, open.Visibility = "priv", VisibilityPublic
+	app := testApp(db{sec, priv, pub, open})
+	tests := []struct {
+		target string
+		auth   bool
+		want   int
+	}{
+		{"/api/v1/qr/pub.svg", false, http.StatusOK},
+		{"/api/v1/qr/pub.svg?target=url", false, http.StatusNotFound},
+		{"/api/v1/qr/open.svg?target=url", false, http.StatusNotFound},
+		{"/api/v1/qr/pub.svg?target=url", true, http.StatusOK},
+		{"/api/v1/qr/open.svg?target=url", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.auth {
+			r.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		w := httptest.NewRecorder()
+		app.qr(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET %s (auth=%t) = %d, want %d", tt.target, tt.auth, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package bookmarks
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A query combines field predicates with AND, OR, NOT and parentheses:
+//
+//	tag:go AND (tag:video OR tag:talk) NOT tag:old host:youtube.com
+//
+// Adjacent terms are joined with AND, and a bare word is a tag predicate.
+// Supported fields are tag, name, host, status and pinned.
+
+// QueryError reports a syntax error at a byte offset of the query.
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e QueryError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+const (
+	opPred = iota
+	opAnd
+	opOr
+	opNot
+)
+
+type queryNode struct {
+	op    int
+	kids  []*queryNode
+	field string
+	value string
+}
+
+type token struct {
+	kind string // "(", ")", "word" or "eof"
+	text string
+	pos  int
+}
+
+func lexQuery(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, token{string(c), string(c), i})
+			i++
+		default:
+			start := i
+			var b strings.Builder
+			for i < len(s) && !strings.ContainsRune(" \t\n()", rune(s[i])) {
+				if s[i] == '"' {
+					end := strings.IndexByte(s[i+1:], '"')
+					if end < 0 {
+						return nil, QueryError{i, "unterminated quote"}
+					}
+					b.WriteString(s[i+1 : i+1+end])
+					i += end + 2
+					continue
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			toks = append(toks, token{"word", b.String(), start})
+		}
+	}
+	return append(toks, token{"eof", "", len(s)}), nil
+}
+
+type queryParser struct {
+	toks []token
+	i    int
+}
+
+func (p *queryParser) peek() token { return p.toks[p.i] }
+func (p *queryParser) next() token { t := p.toks[p.i]; p.i++; return t }
+
+func keyword(t token, kw string) bool {
+	return t.kind == "word" && t.text == kw
+}
+
+// ParseQuery parses q into a query tree.
+func ParseQuery(q string) (*queryNode, error) {
+	toks, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	if p.peek().kind == "eof" {
+		return nil, QueryError{0, "empty query"}
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, QueryError{t.pos, fmt.Sprintf("unexpected %q", t.text)}
+	}
+	return n, nil
+}
+
+func (p *queryParser) parseOr() (*queryNode, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	kids := []*queryNode{n}
+	for keyword(p.peek(), "OR") {
+		p.next()
+		n, err = p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		kids = append(kids, n)
+	}
+	if len(kids) == 1 {
+		return kids[0], nil
+	}
+	return &queryNode{op: opOr, kids: kids}, nil
+}
+
+func (p *queryParser) parseAnd() (*queryNode, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	kids := []*queryNode{n}
+	for {
+		t := p.peek()
+		if t.kind == "eof" || t.kind == ")" || keyword(t, "OR") {
+			break
+		}
+		if keyword(t, "AND") {
+			p.next()
+		}
+		n, err = p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		kids = append(kids, n)
+	}
+	if len(kids) == 1 {
+		return kids[0], nil
+	}
+	return &queryNode{op: opAnd, kids: kids}, nil
+}
+
+func (p *queryParser) parseUnary() (*queryNode, error) {
+	if keyword(p.peek(), "NOT") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNode{op: opNot, kids: []*queryNode{n}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (*queryNode, error) {
+	t := p.next()
+	switch {
+	case t.kind == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != ")" {
+			return nil, QueryError{c.pos, "expected ')'"}
+		}
+		return n, nil
+	case t.kind == "eof":
+		return nil, QueryError{t.pos, "unexpected end of query"}
+	case t.kind == ")":
+		return nil, QueryError{t.pos, "unexpected ')'"}
+	case keyword(t, "AND") || keyword(t, "OR"):
+		return nil, QueryError{t.pos, fmt.Sprintf("unexpected %s", t.text)}
+	}
+	field, value := "tag", t.text
+	if i := strings.IndexByte(t.text, ':'); i >= 0 {
+		field, value = strings.ToLower(t.text[:i]), t.text[i+1:]
+	}
+	if value == "" {
+		return nil, QueryError{t.pos, fmt.Sprintf("missing value for %s", field)}
+	}
+	switch field {
+	case "tag", "host":
+		value = strings.ToLower(value)
+	case "name":
+	case "status":
+		if !ValidStatus(value) {
+			return nil, QueryError{t.pos, fmt.Sprintf("%q is not a valid status", value)}
+		}
+	case "pinned":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return nil, QueryError{t.pos, fmt.Sprintf("%q is not a boolean", value)}
+		}
+	default:
+		return nil, QueryError{t.pos, fmt.Sprintf("unknown field %q", field)}
+	}
+	return &queryNode{op: opPred, field: field, value: value}, nil
+}
+
+// indexed reports whether the predicate can be answered from an index rather
+// than by scanning every bookmark.
+func (n *queryNode) indexed() bool {
+	return n.op == opPred && (n.field == "tag" || n.field == "name")
+}
+
+// estimate returns an upper bound of the number of matches of n, used to
+// order intersections. size is the number of bookmarks in the collection.
+func (n *queryNode) estimate(size int) int {
+	switch n.op {
+	case opPred:
+		switch n.field {
+		case "tag":
+			return len(tagIndex[n.value])
+		case "name":
+			if _, ok := nameIndex[n.value]; ok {
+				return 1
+			}
+			return 0
+		}
+		return size
+	case opAnd:
+		min := size
+		for _, k := range n.kids {
+			if k.op == opNot {
+				continue
+			}
+			if e := k.estimate(size); e < min {
+				min = e
+			}
+		}
+		return min
+	case opOr:
+		sum := 0
+		for _, k := range n.kids {
+			sum += k.estimate(size)
+		}
+		if sum > size {
+			return size
+		}
+		return sum
+	}
+	return size
+}
+
+// match evaluates n against a single bookmark.
+func (n *queryNode) match(b *Bookmark) bool {
+	switch n.op {
+	case opAnd:
+		for _, k := range n.kids {
+			if !k.match(b) {
+				return false
+			}
+		}
+		return true
+	case opOr:
+		for _, k := range n.kids {
+			if k.match(b) {
+				return true
+			}
+		}
+		return false
+	case opNot:
+		return !n.kids[0].match(b)
+	}
+	switch n.field {
+	case "tag":
+		for _, t := range b.Tags {
+			if strings.ToLower(t) == n.value {
+				return true
+			}
+		}
+		return false
+	case "name":
+		return b.Name == n.value
+	case "host":
+		u, err := url.Parse(b.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		return host == n.value || strings.HasSuffix(host, "."+n.value)
+	case "status":
+		return b.State() == n.value
+	case "pinned":
+		v, _ := strconv.ParseBool(n.value)
+		return b.Pinned == v
+	}
+	return false
+}
+
+type bookmarkSet map[*Bookmark]struct{}
+
+// eval returns the bookmarks of all matching n. Indexed predicates are read
+// from their posting lists. Conjunctions start from the operand with the
+// smallest estimate, intersect it with the posting lists of the remaining
+// indexed operands and apply everything else as a filter, so the collection
+// is only scanned when no positive operand is indexed.
+func (n *queryNode) eval(all []*Bookmark) bookmarkSet {
+	r := make(bookmarkSet)
+	switch n.op {
+	case opPred:
+		switch n.field {
+		case "tag":
+			for _, b := range tagIndex[n.value] {
+				r[b] = struct{}{}
+			}
+			return r
+		case "name":
+			if b, ok := nameIndex[n.value]; ok {
+				r[b] = struct{}{}
+			}
+			return r
+		}
+	case opOr:
+		for _, k := range n.kids {
+			for b := range k.eval(all) {
+				r[b] = struct{}{}
+			}
+		}
+		return r
+	case opAnd:
+		pos := make([]*queryNode, 0, len(n.kids))
+		for _, k := range n.kids {
+			if k.op != opNot {
+				pos = append(pos, k)
+			}
+		}
+		if len(pos) > 0 {
+			size := len(all)
+			sort.SliceStable(pos, func(i, j int) bool { return pos[i].estimate(size) < pos[j].estimate(size) })
+			r = pos[0].eval(all)
+			rest := make([]*queryNode, 0, len(n.kids))
+			for _, k := range pos[1:] {
+				if k.indexed() {
+					r = intersect(r, k.eval(all))
+				} else {
+					rest = append(rest, k)
+				}
+			}
+			for _, k := range n.kids {
+				if k.op == opNot {
+					rest = append(rest, k)
+				}
+			}
+			for b := range r {
+				for _, k := range rest {
+					if !k.match(b) {
+						delete(r, b)
+						break
+					}
+				}
+			}
+			return r
+		}
+	}
+	// negations and unindexed predicates need a full scan
+	for _, b := range all {
+		if n.match(b) {
+			r[b] = struct{}{}
+		}
+	}
+	return r
+}
+
+// intersect returns the members of a that are also in b.
+func intersect(a, b bookmarkSet) bookmarkSet {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	r := make(bookmarkSet, len(a))
+	for k := range a {
+		if _, ok := b[k]; ok {
+			r[k] = struct{}{}
+		}
+	}
+	return r
+}
+
+// Query returns the bookmarks of d matching the query q.
+func (d db) Query(q string) ([]*Bookmark, error) {
+	n, err := ParseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	set := n.eval(d)
+	r := make([]*Bookmark, 0, len(set))
+	for _, b := range d {
+		if _, ok := set[b]; ok {
+			r = append(r, b)
+		}
+	}
+	return r, nil
+}
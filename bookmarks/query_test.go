@@ -0,0 +1,88 @@
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+// sexp renders n as an s-expression, e.g. (and tag:go (not tag:old)).
+func sexp(n *queryNode) string {
+	if n.op == opPred {
+		return n.field + ":" + n.value
+	}
+	op := map[int]string{opAnd: "and", opOr: "or", opNot: "not"}[n.op]
+	parts := []string{op}
+	for _, k := range n.kids {
+		parts = append(parts, sexp(k))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"go", "tag:go"},
+		{"Go", "tag:go"},
+		{"tag:go video", "(and tag:go tag:video)"},
+		{"tag:go AND tag:video", "(and tag:go tag:video)"},
+		{"a OR b c", "(or tag:a (and tag:b tag:c))"},
+		{"a b OR c", "(or (and tag:a tag:b) tag:c)"},
+		{"a OR b OR c", "(or tag:a tag:b tag:c)"},
+		{"NOT a b", "(and (not tag:a) tag:b)"},
+		{"NOT NOT a", "(not (not tag:a))"},
+		{"NOT (a OR b)", "(not (or tag:a tag:b))"},
+		{"(a OR b) c", "(and (or tag:a tag:b) tag:c)"},
+		{"a AND (b OR (c NOT d))", "(and tag:a (or tag:b (and tag:c (not tag:d))))"},
+		{"name:Docs host:Example.COM", "(and name:Docs host:example.com)"},
+		{"status:reading pinned:true", "(and status:reading pinned:true)"},
+		{`name:"a b"`, "name:a b"},
+		{"tag:go NOT tag:old host:youtube.com", "(and tag:go (not tag:old) host:youtube.com)"},
+	}
+	for _, tt := range tests {
+		n, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := sexp(n); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"", 0, "empty query"},
+		{"   ", 0, "empty query"},
+		{"(a", 2, "expected ')'"},
+		{"a)", 1, `unexpected ")"`},
+		{")", 0, "unexpected ')'"},
+		{"a OR", 4, "unexpected end of query"},
+		{"NOT", 3, "unexpected end of query"},
+		{"AND a", 0, "unexpected AND"},
+		{"a OR OR b", 5, "unexpected OR"},
+		{"()", 1, "unexpected ')'"},
+		{`name:"a b`, 5, "unterminated quote"},
+		{"tag:", 0, "missing value for tag"},
+		{"color:red", 0, `unknown field "color"`},
+		{"a status:new", 2, `"new" is not a valid status`},
+		{"pinned:maybe", 0, `"maybe" is not a boolean`},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		qe, ok := err.(QueryError)
+		if !ok {
+			t.Errorf("ParseQuery(%q) error = %v, want a QueryError", tt.query, err)
+			continue
+		}
+		if qe.Pos != tt.pos || qe.Msg != tt.msg {
+			t.Errorf("ParseQuery(%q) error = %d %q, want %d %q", tt.query, qe.Pos, qe.Msg, tt.pos, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package bookmarks
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// missingPage is shown for names that resolve to nothing.
+var missingPage = template.Must(template.New("missing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}: not found{{if .Host}} on {{.Host}}{{end}}</title>
+<link rel="search" type="application/opensearchdescription+xml" title="go" href="/opensearch.xml">
+</head>
+<body>
+<h1>{{.Name}} is not a bookmark{{if .Host}} on {{.Host}}{{end}}</h1>
+{{if .Matches}}<p>Did you mean:</p>
+<ul>
+{{range .Matches}}<li><a href="{{$.Prefix}}{{.}}">{{.}}</a></li>
+{{end}}</ul>
+{{end}}{{if .CanCreate}}<h2>Create it</h2>
+<form method="post" action="/api/v1/create">
+<input type="hidden" name="name" value="{{.FullName}}">
+<p><label>URL <input type="url" name="url" required></label></p>
+<p><label>Tags <input type="text" name="tags" required></label></p>
+<p><button type="submit">Create {{.Name}}</button></p>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// previewPage shows where a go-link leads before following it.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}: preview</title>
+<link rel="search" type="application/opensearchdescription+xml" title="go" href="/opensearch.xml">
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Error}}<p>{{.Error}}</p>
+{{else}}<p>leads to <a href="{{.Target}}">{{.Target}}</a></p>
+{{end}}<dl>
+{{if .Title}}<dt>Title</dt><dd>{{.Title}}</dd>
+{{end}}{{if .Alias}}<dt>Alias of</dt><dd>{{.Alias}}</dd>
+{{end}}{{if .Envs}}<dt>Environments</dt><dd>{{range $i, $e := .EnvNames}}{{if $i}}, {{end}}<a href="?env={{$e}}">{{$e}}</a>{{end}}</dd>
+{{end}}<dt>Tags</dt><dd>{{range $i, $t := .Tags}}{{if $i}}, {{end}}{{$t}}{{end}}</dd>
+<dt>Created by</dt><dd>{{if .Creator}}{{.Creator}}{{else}}unknown{{end}}</dd>
+<dt>Created</dt><dd>{{.Created}}</dd>
+<dt>Views</dt><dd>{{.Views}}</dd>
+</dl>
+{{if not .Error}}<p><a href="{{.Continue}}"><button type="button">Continue to {{.Target}}</button></a></p>
+{{end}}</body>
+</html>
+`))
+
+// redirect returns a handler sending GET {prefix}{name}/{args...} to the URL
+// of the bookmark name, expanded with args and the query, counting the visit
+// and recording the click in the stats. Names of smart collections answer
+// with their listing. A trailing '+' shows the preview page instead, and
+// {prefix}?q=name args, as submitted by browser search, goes to the go-link.
+// Password protected links ask for the password, which is POSTed back, and
+// links with a click limit stop redirecting once it is used up. On virtual
+// hosts, names are looked up in the namespace of the host.
+func (app *application) redirect(prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		if q := r.URL.Query().Get("q"); path == "" && strings.TrimSpace(q) != "" {
+			http.Redirect(w, r, prefix+searchPath(q), http.StatusFound)
+			return
+		}
+		if strings.HasSuffix(path, "+") {
+			app.previewGoLink(w, r, prefix, strings.TrimSuffix(path, "+"))
+			return
+		}
+		name, args := app.goName(r, path)
+		if b, ok := nameIndex[name]; ok && !b.Expired(time.Now().Unix()) && app.followable(r, b) {
+			dest, err := resolve(b)
+			if err != nil || !app.followable(r, dest) || dest.Expired(time.Now().Unix()) {
+				msg := name + ": alias target is not available"
+				if err != nil {
+					msg = err.Error()
+				}
+				http.Error(w, msg, http.StatusNotFound)
+				return
+			}
+			target, err := expandFor(r, dest, args)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %s", name, err), http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodPost && !dest.Protected {
+				w.Header().Set("Allow", http.MethodGet)
+				http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
+				return
+			}
+			if dest.usedUp() {
+				http.Error(w, name+": link has been used up", http.StatusGone)
+				return
+			}
+			if dest.Protected && !app.unlock(w, r, name, dest) {
+				return
+			}
+			if r.Method == http.MethodHead && dest.ClicksLeft != nil {
+				// link checkers must not use up clicks
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if !dest.takeClick() {
+				http.Error(w, name+": link has been used up", http.StatusGone)
+				return
+			}
+			b.Update()
+			click := newClick(r, time.Now().Unix())
+			app.stats.record(b.Name, click)
+			if dest != b {
+				dest.Update()
+				app.stats.record(dest.Name, click)
+			}
+			app.infoLog.Printf("redirect %s -> %s\n", name, target)
+			if dest.ClicksLeft != nil {
+				// persist the count right away so a restart cannot reset it
+				app.Save()
+			}
+			status := http.StatusFound
+			if dest.Protected {
+				w.Header().Set("Cache-Control", "no-store")
+				status = http.StatusSeeOther
+			}
+			http.Redirect(w, r, target, status)
+			return
+		}
+		if s, ok := app.smart[name]; ok {
+			// served here, as the API is not reachable on the GoRoutes listener
+			w.Header().Set("Content-Type", "application/json")
+			app.evalSmart(w, r, s)
+			return
+		}
+		app.missing(w, r, prefix, name)
+	}
+}
+
+// previewGoLink renders the preview page for path, the go-link without its
+// trailing '+'. The visit is not counted; continuing follows the go-link.
+func (app *application) previewGoLink(w http.ResponseWriter, r *http.Request, prefix, path string) {
+	name, args := app.goName(r, path)
+	b, ok := nameIndex[name]
+	if !ok || !live(b, false) || !app.resolvable(r, b) {
+		app.missing(w, r, prefix, name)
+		return
+	}
+	data := struct {
+		*Bookmark
+		Target   string
+		Continue string
+		Created  string
+		Error    string
+	}{Bookmark: b, Created: time.Unix(b.Created, 0).Format("2006-01-02 15:04")}
+	cont := url.URL{Path: prefix + path, RawQuery: r.URL.RawQuery}
+	data.Continue = cont.String()
+	status := http.StatusOK
+	dest, err := resolve(b)
+	if err == nil && (!live(dest, false) || !app.resolvable(r, dest)) {
+		err = fmt.Errorf("%s: alias target is not available", name)
+	}
+	if err == nil {
+		data.Target, err = expandFor(r, dest, args)
+	}
+	if err != nil {
+		data.Error = err.Error()
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := previewPage.Execute(w, data); err != nil {
+		app.errorLog.Printf("rendering error: %s\n", err.Error())
+	}
+}
+
+// missing renders the page for an unknown name, given in full, with the
+// closest names of its namespace r may see and, if r may create bookmarks, a
+// form to create it. Names are shown relative to the namespace of the host.
+func (app *application) missing(w http.ResponseWriter, r *http.Request, prefix, name string) {
+	data := struct {
+		Name      string
+		FullName  string
+		Host      string
+		Prefix    string
+		Matches   []string
+		CanCreate bool
+	}{FullName: name, Prefix: prefix}
+	ns := app.namespace(r)
+	if _, ok := app.virtualHost(r); ok {
+		data.Host = r.Host
+	}
+	data.Name, _ = unqualify(ns, name)
+	own := ""
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		own = name[:i]
+	}
+	for _, s := range suggest(name, func(b *Bookmark) bool {
+		_, in := unqualify(own, b.Name)
+		return in && app.listed(r, b) && live(b, false)
+	}) {
+		if len(data.Matches) == maxSuggestions {
+			break
+		}
+		short, _ := unqualify(ns, s.Name)
+		data.Matches = append(data.Matches, short)
+	}
+	data.CanCreate = name != "" && ValidateName(name) == nil && app.authenticated(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	if err := missingPage.Execute(w, data); err != nil {
+		app.errorLog.Printf("rendering error: %s\n", err.Error())
+	}
+}
+
+// GoRoutes serves /{name} redirects, for running on a dedicated listener
+// such as a short host name.
+func (app *application) GoRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", app.redirect("/"))
+	mux.HandleFunc("/api/v1/create", app.authOnly(app.createBookmark))
+	mux.HandleFunc("/opensearch.xml", app.openSearch("/"))
+	mux.HandleFunc("/api/v1/suggest", app.openSearchSuggest("/"))
+	return mux
+}
@@ -0,0 +1,200 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types a custom field may have.
+const (
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldDate   = "date"
+	FieldEnum   = "enum"
+	FieldURL    = "url"
+)
+
+// fieldPrefix marks custom field values in form and query parameters,
+// e.g. field.owner=alice.
+const fieldPrefix = "field."
+
+const schemaFile = "db.schema"
+
+// FieldDef describes a custom field that bookmarks of the collection may carry.
+type FieldDef struct {
+	Name     string
+	Type     string
+	Values   []string `json:",omitempty"`
+	Required bool     `json:",omitempty"`
+}
+
+// Schema maps field names to their definitions.
+type Schema map[string]FieldDef
+
+func validFieldType(t string) bool {
+	switch t {
+	case FieldString, FieldInt, FieldDate, FieldEnum, FieldURL:
+		return true
+	}
+	return false
+}
+
+func (f FieldDef) error(msg string) error {
+	return FieldError{Field: fieldPrefix + f.Name, Message: msg}
+}
+
+// normalize checks value against the field type and returns its canonical
+// form, which is what gets stored and compared.
+func (f FieldDef) normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch f.Type {
+	case FieldInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", f.error(fmt.Sprintf("%q is not an integer", value))
+		}
+		return strconv.FormatInt(n, 10), nil
+	case FieldDate:
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return "", f.error(fmt.Sprintf("%q is not a date (YYYY-MM-DD)", value))
+		}
+		return t.Format("2006-01-02"), nil
+	case FieldEnum:
+		for _, v := range f.Values {
+			if v == value {
+				return value, nil
+			}
+		}
+		return "", f.error(fmt.Sprintf("%q is not one of %s", value, strings.Join(f.Values, ",")))
+	case FieldURL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", f.error(fmt.Sprintf("%q is not an absolute url", value))
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// Validate normalizes the given field values against the schema. Unknown
+// fields are rejected, and when create is set, so are missing required ones.
+// Every rejected field is reported in the returned ValidationError.
+func (s Schema) Validate(fields map[string]string, create bool) (map[string]string, error) {
+	var errs ValidationError
+	r := make(map[string]string, len(fields))
+	for k, v := range fields {
+		def, ok := s[k]
+		if !ok {
+			errs.add("", FieldError{fieldPrefix + k, "unknown field"})
+			continue
+		}
+		if v == "" {
+			continue
+		}
+		n, err := def.normalize(v)
+		if err != nil {
+			errs.add("", err)
+			continue
+		}
+		r[k] = n
+	}
+	if create {
+		for _, def := range s {
+			if _, ok := r[def.Name]; def.Required && !ok {
+				errs.add("", def.error("missing required field"))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return nil, errs
+	}
+	return r, nil
+}
+
+// fieldValues collects the field.<name> parameters of v.
+func fieldValues(v url.Values) map[string]string {
+	r := make(map[string]string)
+	for k := range v {
+		if strings.HasPrefix(k, fieldPrefix) {
+			r[strings.TrimPrefix(k, fieldPrefix)] = v.Get(k)
+		}
+	}
+	return r
+}
+
+func (app *application) loadSchema() {
+	file, err := os.Open(schemaFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			app.errorLog.Println(err)
+		}
+		return
+	}
+	defer file.Close()
+	if err = json.NewDecoder(file).Decode(&app.schema); err != nil {
+		app.errorLog.Println("failed to decode schema", err)
+	}
+}
+
+func (app *application) saveSchema() error {
+	file, err := os.Create(schemaFile)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(app.schema)
+}
+
+// Schema lists (GET), defines (POST) or removes (DELETE) custom fields.
+func (app *application) Schema(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/schema"), "/")
+	switch r.Method {
+	case http.MethodGet:
+		defs := make([]FieldDef, 0, len(app.schema))
+		for _, def := range app.schema {
+			defs = append(defs, def)
+		}
+		sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+		json.NewEncoder(w).Encode(defs)
+	case http.MethodPost:
+		def := FieldDef{
+			Name:     r.FormValue("name"),
+			Type:     r.FormValue("type"),
+			Required: r.FormValue("required") == "1",
+		}
+		if def.Name == "" || !validFieldType(def.Type) {
+			http.Error(w, "name and a type of string, int, date, enum or url are required", http.StatusBadRequest)
+			return
+		}
+		if v := r.FormValue("values"); v != "" {
+			def.Values = strings.Split(v, ",")
+		}
+		if def.Type == FieldEnum && len(def.Values) == 0 {
+			http.Error(w, "enum fields need values", http.StatusBadRequest)
+			return
+		}
+		app.schema[def.Name] = def
+		app.saveSchema()
+		fmt.Fprintf(w, "defined %s", def.Name)
+	case http.MethodDelete:
+		if _, ok := app.schema[name]; !ok {
+			http.Error(w, fmt.Sprintf("%s: no such field", name), http.StatusNotFound)
+			return
+		}
+		delete(app.schema, name)
+		app.saveSchema()
+		fmt.Fprintf(w, "%s deleted", name)
+	default:
+		http.Error(w, "invalid method", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,294 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"html"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// BM25 tuning parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Per-field weights: a term in the name counts as much as three in the notes.
+const (
+	weightName  = 3
+	weightTitle = 2
+	weightTag   = 2
+	weightURL   = 1
+	weightNotes = 1
+)
+
+// textIndex is an inverted index from terms to the bookmarks containing them.
+type textIndex struct {
+	postings map[string]map[*Bookmark]int
+	docs     map[*Bookmark]map[string]int
+	lens     map[*Bookmark]int
+	totalLen int
+}
+
+var searchIndex = newTextIndex()
+
+func newTextIndex() *textIndex {
+	return &textIndex{
+		postings: make(map[string]map[*Bookmark]int),
+		docs:     make(map[*Bookmark]map[string]int),
+		lens:     make(map[*Bookmark]int),
+	}
+}
+
+// tokenize splits s into lowercase runs of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// urlTokens returns the host labels and path segments of raw.
+func urlTokens(raw string) []string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return tokenize(raw)
+	}
+	return append(tokenize(u.Hostname()), tokenize(u.Path)...)
+}
+
+// terms returns the weighted term frequencies of b.
+func terms(b *Bookmark) map[string]int {
+	tf := make(map[string]int)
+	add := func(tokens []string, weight int) {
+		for _, t := range tokens {
+			tf[t] += weight
+		}
+	}
+	add(tokenize(b.Name), weightName)
+	add(tokenize(b.Title), weightTitle)
+	add(urlTokens(b.URL), weightURL)
+	for _, t := range b.Tags {
+		add(tokenize(t), weightTag)
+	}
+	add(tokenize(b.Notes), weightNotes)
+	return tf
+}
+
+// add indexes b, replacing any previous entry for it.
+func (ix *textIndex) add(b *Bookmark) {
+	ix.remove(b)
+	tf := terms(b)
+	for t, n := range tf {
+		if ix.postings[t] == nil {
+			ix.postings[t] = make(map[*Bookmark]int)
+		}
+		ix.postings[t][b] = n
+		ix.lens[b] += n
+	}
+	ix.totalLen += ix.lens[b]
+	ix.docs[b] = tf
+}
+
+// remove drops b from the index.
+func (ix *textIndex) remove(b *Bookmark) {
+	tf, ok := ix.docs[b]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(ix.postings[t], b)
+		if len(ix.postings[t]) == 0 {
+			delete(ix.postings, t)
+		}
+	}
+	ix.totalLen -= ix.lens[b]
+	delete(ix.docs, b)
+	delete(ix.lens, b)
+}
+
+// SearchResult is a bookmark matching a full-text query.
+type SearchResult struct {
+	*Bookmark
+	Score   float64
+	Snippet string `json:",omitempty"`
+}
+
+// search ranks the indexed bookmarks against query using BM25.
+func (ix *textIndex) search(query string) []SearchResult {
+	q := tokenize(query)
+	if len(q) == 0 || len(ix.docs) == 0 {
+		return nil
+	}
+	n := float64(len(ix.docs))
+	avg := float64(ix.totalLen) / n
+	scores := make(map[*Bookmark]float64)
+	seen := make(map[string]bool)
+	for _, t := range q {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		posting := ix.postings[t]
+		df := float64(len(posting))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for b, f := range posting {
+			tf := float64(f)
+			dl := float64(ix.lens[b])
+			scores[b] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*dl/avg))
+		}
+	}
+	r := make([]SearchResult, 0, len(scores))
+	for b, s := range scores {
+		r = append(r, SearchResult{Bookmark: b, Score: s})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		return r[i].Name < r[j].Name
+	})
+	return r
+}
+
+const snippetRadius = 60
+
+// snippet returns an excerpt around the first match in the first field of b
+// that contains one of terms, with matching words wrapped in <mark></mark>.
+// The text is HTML escaped, so the snippet can be shown as is.
+func snippet(b *Bookmark, terms map[string]bool) string {
+	for _, text := range []string{b.Notes, b.Title, b.URL, b.Name, strings.Join(b.Tags, ", ")} {
+		words := wordSpans(text)
+		first := -1
+		for i, w := range words {
+			if terms[strings.ToLower(text[w[0]:w[1]])] {
+				first = i
+				break
+			}
+		}
+		if first == -1 {
+			continue
+		}
+		from, to := words[first][0]-snippetRadius, words[first][1]+snippetRadius
+		if from < 0 {
+			from = 0
+		}
+		if to > len(text) {
+			to = len(text)
+		}
+		// do not cut words in half
+		for _, w := range words {
+			if w[0] < from && w[1] > from {
+				from = w[0]
+			}
+			if w[0] < to && w[1] > to {
+				to = w[1]
+			}
+		}
+		var out strings.Builder
+		if from > 0 {
+			out.WriteString("…")
+		}
+		last := from
+		for _, w := range words {
+			if w[0] < from || w[1] > to || !terms[strings.ToLower(text[w[0]:w[1]])] {
+				continue
+			}
+			out.WriteString(html.EscapeString(text[last:w[0]]))
+			out.WriteString("<mark>" + html.EscapeString(text[w[0]:w[1]]) + "</mark>")
+			last = w[1]
+		}
+		out.WriteString(html.EscapeString(text[last:to]))
+		if to < len(text) {
+			out.WriteString("…")
+		}
+		return out.String()
+	}
+	return ""
+}
+
+// wordSpans returns the byte offsets of the words of s, as split by tokenize.
+func wordSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start == -1 {
+			start = i
+		} else if !word && start != -1 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start != -1 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// rebuildSearch indexes every bookmark of d from scratch.
+func (d db) rebuildSearch() {
+	searchIndex = newTextIndex()
+	for _, b := range d {
+		searchIndex.add(b)
+	}
+}
+
+// search answers /api/v1/search?q= with BM25 ranked results, or in the
+// order given by sort.
+func (app *application) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		badRequest(w, FieldError{"q", "missing query"})
+		return
+	}
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			badRequest(w, FieldError{"limit", l + " is not a positive number"})
+			return
+		}
+		limit = n
+	}
+	order, err := parseOrder(r.URL.Query().Get("sort"))
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	expired := includeExpired(r)
+	terms := make(map[string]bool)
+	for _, t := range tokenize(q) {
+		terms[t] = true
+	}
+	results := make([]SearchResult, 0)
+	for _, res := range searchIndex.search(q) {
+		if !live(res.Bookmark, expired) || !app.listed(r, res.Bookmark) {
+			continue
+		}
+		results = append(results, res)
+	}
+	if order.key != "" {
+		sort.SliceStable(results, func(i, j int) bool {
+			return order.less(results[i].Bookmark, results[j].Bookmark)
+		})
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i].Snippet = snippet(results[i].Bookmark, terms)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(results); err != nil {
+		app.errorLog.Printf("encoding error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,155 @@
+package bookmarks
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Bounds of the short code length. Seven characters give 62^7, about 3.5
+// trillion, codes.
+const (
+	DefaultCodeLength = 7
+	MinCodeLength     = 4
+	maxCodeAttempts   = 10
+)
+
+var codeLength = DefaultCodeLength
+
+// SetCodeLength sets the length of generated short codes.
+func SetCodeLength(n int) error {
+	if n < MinCodeLength || n > MaxNameLength {
+		return fmt.Errorf("short code length must be between %d and %d", MinCodeLength, MaxNameLength)
+	}
+	codeLength = n
+	return nil
+}
+
+// randomCode returns n random base62 characters. Bytes that would bias the
+// distribution are rejected rather than folded with a modulo.
+func randomCode(n int) (string, error) {
+	code := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(code) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			// 248 is the largest multiple of 62 that fits in a byte
+			if c < 248 && len(code) < n {
+				code = append(code, base62[c%62])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// newCode returns a random code not yet used as a bookmark name in the
+// namespace ns, nor reserved for the API.
+func newCode(ns string) (string, error) {
+	for i := 0; i < maxCodeAttempts; i++ {
+		code, err := randomCode(codeLength)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := nameIndex[qualify(ns, code)]; !ok && !reserved(code) {
+			return code, nil
+		}
+	}
+	return "", errors.New("no free short code found, consider a longer code length")
+}
+
+// ShortLink is the answer to a shorten request.
+type ShortLink struct {
+	Code       string
+	URL        string
+	Short      string
+	Protected  bool   `json:",omitempty"`
+	ClicksLeft *int32 `json:",omitempty"`
+}
+
+// reusable returns a bookmark of the namespace ns for the canonical url
+// canon that can be handed out as its short link: live, public or unlisted,
+// and neither password protected nor limited in clicks.
+func (app *application) reusable(ns, canon string) *Bookmark {
+	ok := func(b *Bookmark) bool {
+		return live(b, false) && b.Access() != VisibilityPrivate &&
+			!b.Protected && b.ClicksLeft == nil && inNamespace(ns, b)
+	}
+	if b, found := urlIndex[canon]; found && ok(b) {
+		return b
+	}
+	// the index keeps one bookmark per url, which may be a private one
+	for _, b := range *app.db {
+		if !b.IsAlias() && ok(b) && Canonical(b.URL) == canon {
+			return b
+		}
+	}
+	return nil
+}
+
+// shorten answers POST /api/v1/shorten?url= with a short code for the URL.
+// A URL already stored as a public or unlisted bookmark keeps the name it has;
+// others are added as unlisted bookmarks named by a random code. Links with a
+// password or max_clicks always get a code of their own. On virtual hosts,
+// codes are made in the namespace of the host.
+func (app *application) shorten(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
+		return
+	}
+	target := r.FormValue("url")
+	if err := ValidateURL(target); err != nil {
+		badRequest(w, err)
+		return
+	}
+	ns := app.namespace(r)
+	link := func(b *Bookmark) ShortLink {
+		code, _ := unqualify(ns, b.Name)
+		return ShortLink{code, b.URL, app.goLink(r, b), b.Protected, b.ClicksLeft}
+	}
+	var errs ValidationError
+	bk := NewBookmark("", target, nil)
+	errs.add("password", bk.SetPassword(r.FormValue("password")))
+	if v := r.FormValue("max_clicks"); v != "" {
+		left, err := parseMaxClicks(v)
+		errs.add("max_clicks", err)
+		bk.ClicksLeft = left
+	}
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
+	if !bk.Protected && bk.ClicksLeft == nil {
+		if b := app.reusable(ns, Canonical(target)); b != nil {
+			json.NewEncoder(w).Encode(link(b))
+			return
+		}
+	}
+	code, err := newCode(ns)
+	if err != nil {
+		app.errorLog.Println(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bk.Name = qualify(ns, code)
+	bk.Visibility = VisibilityUnlisted
+	if err := bk.Normalize(); err != nil {
+		badRequest(w, err)
+		return
+	}
+	if err := app.db.Add(bk); err != nil {
+		app.errorLog.Printf("failed to shorten %s: %s\n", target, err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	app.infoLog.Printf("shortened: %s", bk)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link(bk))
+	app.Save()
+}
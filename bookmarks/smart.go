@@ -0,0 +1,173 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+const smartFile = "db.smart"
+
+// smartCriteria are the find parameters selecting the bookmarks of a smart
+// collection; smartOptions only shape the response and may be overridden
+// when the collection is requested.
+var (
+	smartCriteria = []string{
+		"name", "url", "tag", "q", "status", "pinned",
+		"created_after", "created_before", "accessed_after", "accessed_before",
+		"views_min", "views_max", "name_re", "url_re",
+	}
+	smartOptions = []string{"sort", "fields", "limit", "cursor", "include_expired"}
+)
+
+// SmartCollection is a saved lookup, evaluated against the current
+// bookmarks every time it is requested.
+type SmartCollection struct {
+	Name string
+	// Params are the find parameters of the lookup, URL encoded.
+	Params string
+}
+
+// Smart maps names to smart collections.
+type Smart map[string]SmartCollection
+
+// parseSmart checks that params form a valid lookup and returns the saved
+// criteria, plus the sort and fields options.
+func parseSmart(params string, schema Schema) (url.Values, error) {
+	q, err := url.ParseQuery(params)
+	if err != nil {
+		return nil, FieldError{"params", err.Error()}
+	}
+	r := make(url.Values)
+	for k := range q {
+		if strings.HasPrefix(k, fieldPrefix) {
+			r.Set(k, q.Get(k))
+		}
+	}
+	for _, k := range smartCriteria {
+		if v := q.Get(k); v != "" {
+			r.Set(k, v)
+		}
+	}
+	if len(r) == 0 {
+		return nil, FieldError{"params", "one of " + strings.Join(smartCriteria, ", ") + " or a field is required"}
+	}
+	for _, k := range []string{"sort", "fields"} {
+		if v := q.Get(k); v != "" {
+			r.Set(k, v)
+		}
+	}
+	var errs ValidationError
+	_, err = parseListFilter(r, schema)
+	errs.add("", err)
+	_, err = parsePage(r)
+	errs.add("", err)
+	if query := r.Get("q"); query != "" {
+		if _, err = ParseQuery(query); err != nil {
+			errs.add("q", FieldError{"q", err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return r, nil
+}
+
+func (app *application) loadSmart() {
+	file, err := os.Open(smartFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			app.errorLog.Println(err)
+		}
+		return
+	}
+	defer file.Close()
+	if err = json.NewDecoder(file).Decode(&app.smart); err != nil {
+		app.errorLog.Println("failed to decode smart collections", err)
+	}
+}
+
+func (app *application) saveSmart() error {
+	file, err := os.Create(smartFile)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(app.smart)
+}
+
+// evalSmart answers r with the bookmarks of the smart collection s. The
+// response options of r override the saved ones.
+func (app *application) evalSmart(w http.ResponseWriter, r *http.Request, s SmartCollection) {
+	q, err := url.ParseQuery(s.Params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, k := range smartOptions {
+		if v := r.URL.Query().Get(k); v != "" {
+			q.Set(k, v)
+		}
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	app.find(w, r2)
+}
+
+// smartCollections lists (GET /api/v1/smart), defines (POST) or removes
+// (DELETE /api/v1/smart/{name}) smart collections, and evaluates them
+// (GET /api/v1/smart/{name}).
+func (app *application) smartCollections(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/smart"), "/")
+	if r.Method == http.MethodGet && name != "" {
+		s, ok := app.smart[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("%s: no such smart collection", name), http.StatusNotFound)
+			return
+		}
+		app.evalSmart(w, r, s)
+		return
+	}
+	if !app.authenticated(r) {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		list := make([]SmartCollection, 0, len(app.smart))
+		for _, s := range app.smart {
+			list = append(list, s)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		json.NewEncoder(w).Encode(list)
+	case http.MethodPost:
+		s := SmartCollection{Name: r.FormValue("name")}
+		var errs ValidationError
+		errs.add("name", ValidateName(s.Name))
+		params, err := parseSmart(r.FormValue("params"), app.schema)
+		errs.add("", err)
+		if len(errs) > 0 {
+			badRequest(w, errs)
+			return
+		}
+		s.Params = params.Encode()
+		app.smart[s.Name] = s
+		app.saveSmart()
+		fmt.Fprintf(w, "saved %s", s.Name)
+	case http.MethodDelete:
+		if _, ok := app.smart[name]; !ok {
+			http.Error(w, fmt.Sprintf("%s: no such smart collection", name), http.StatusNotFound)
+			return
+		}
+		delete(app.smart, name)
+		app.saveSmart()
+		fmt.Fprintf(w, "%s deleted", name)
+	default:
+		http.Error(w, "invalid method", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,437 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const statsFile = "db.stats"
+
+// Clicks on redirects are kept raw for rollupAfter, then folded into hourly
+// buckets. Hourly buckets older than hourRetention are folded into daily
+// buckets, which are kept for good.
+const (
+	DefaultRollupAfter = 7 * 24 * time.Hour
+	hourRetention      = 30 * 24 * time.Hour
+	defaultStatsHours  = 24
+	defaultStatsDays   = 30
+	maxStatsDays       = 366
+	defaultTopN        = 10
+	maxTopN            = 100
+)
+
+var rollupAfter = DefaultRollupAfter
+
+// SetRollupAfter sets how long raw clicks are kept before they are rolled
+// up into hourly buckets.
+func SetRollupAfter(d time.Duration) error {
+	if d < time.Hour || d > hourRetention {
+		return fmt.Errorf("rollup period must be between %s and %s", time.Hour, hourRetention)
+	}
+	rollupAfter = d
+	return nil
+}
+
+// Click is one followed redirect, made through the host Host.
+type Click struct {
+	Time     int64
+	Host     string `json:",omitempty"`
+	Referrer string `json:",omitempty"`
+	Agent    string `json:",omitempty"`
+}
+
+// bucket counts the clicks made through Host in the hour or day starting at
+// Start.
+type bucket struct {
+	Start     int64
+	Host      string `json:",omitempty"`
+	Clicks    int
+	Referrers map[string]int `json:",omitempty"`
+	Agents    map[string]int `json:",omitempty"`
+}
+
+func (b *bucket) add(c Click) {
+	b.Clicks++
+	if c.Referrer != "" {
+		if b.Referrers == nil {
+			b.Referrers = make(map[string]int)
+		}
+		b.Referrers[c.Referrer]++
+	}
+	if c.Agent != "" {
+		if b.Agents == nil {
+			b.Agents = make(map[string]int)
+		}
+		b.Agents[c.Agent]++
+	}
+}
+
+func (b *bucket) merge(o *bucket) {
+	b.Clicks += o.Clicks
+	for k, v := range o.Referrers {
+		if b.Referrers == nil {
+			b.Referrers = make(map[string]int)
+		}
+		b.Referrers[k] += v
+	}
+	for k, v := range o.Agents {
+		if b.Agents == nil {
+			b.Agents = make(map[string]int)
+		}
+		b.Agents[k] += v
+	}
+}
+
+// clickLog holds the clicks of one bookmark; Hours and Days are sorted by
+// Start, then Host.
+type clickLog struct {
+	Raw   []Click   `json:",omitempty"`
+	Hours []*bucket `json:",omitempty"`
+	Days  []*bucket `json:",omitempty"`
+}
+
+// into adds o to the bucket of its host starting at start in list, keeping
+// it sorted.
+func into(list []*bucket, start int64, o *bucket) []*bucket {
+	i := sort.Search(len(list), func(i int) bool {
+		return list[i].Start > start || (list[i].Start == start && list[i].Host >= o.Host)
+	})
+	if i == len(list) || list[i].Start != start || list[i].Host != o.Host {
+		list = append(list, nil)
+		copy(list[i+1:], list[i:])
+		list[i] = &bucket{Start: start, Host: o.Host}
+	}
+	list[i].merge(o)
+	return list
+}
+
+func hourOf(t int64) int64 {
+	return t - t%3600
+}
+
+func dayOf(t int64) int64 {
+	return t - t%86400
+}
+
+// rollup folds raw clicks and hourly buckets that have aged out.
+func (l *clickLog) rollup(now int64) {
+	rawLimit := now - int64(rollupAfter/time.Second)
+	keep := l.Raw[:0]
+	for _, c := range l.Raw {
+		if c.Time >= rawLimit {
+			keep = append(keep, c)
+			continue
+		}
+		b := &bucket{Host: c.Host}
+		b.add(c)
+		l.Hours = into(l.Hours, hourOf(c.Time), b)
+	}
+	l.Raw = keep
+	hourLimit := hourOf(now - int64(hourRetention/time.Second))
+	n := 0
+	for _, h := range l.Hours {
+		if h.Start >= hourLimit {
+			break
+		}
+		l.Days = into(l.Days, dayOf(h.Start), h)
+		n++
+	}
+	l.Hours = l.Hours[n:]
+}
+
+// merge adds the clicks of o to l.
+func (l *clickLog) merge(o *clickLog) {
+	l.Raw = append(l.Raw, o.Raw...)
+	sort.Slice(l.Raw, func(i, j int) bool { return l.Raw[i].Time < l.Raw[j].Time })
+	for _, h := range o.Hours {
+		l.Hours = into(l.Hours, h.Start, h)
+	}
+	for _, d := range o.Days {
+		l.Days = into(l.Days, d.Start, d)
+	}
+}
+
+// clickStats maps bookmark names to their clicks. Redirects record clicks
+// concurrently with the periodic rollup and save, hence the lock.
+type clickStats struct {
+	sync.Mutex
+	logs map[string]*clickLog
+}
+
+func newClickStats() *clickStats {
+	return &clickStats{logs: make(map[string]*clickLog)}
+}
+
+func (s *clickStats) record(name string, c Click) {
+	s.Lock()
+	defer s.Unlock()
+	l, ok := s.logs[name]
+	if !ok {
+		l = &clickLog{}
+		s.logs[name] = l
+	}
+	l.Raw = append(l.Raw, c)
+}
+
+func (s *clickStats) rollup(now int64) {
+	s.Lock()
+	defer s.Unlock()
+	for _, l := range s.logs {
+		l.rollup(now)
+	}
+}
+
+// rename moves the clicks of from to to, adding to any clicks to has.
+func (s *clickStats) rename(from, to string) {
+	s.Lock()
+	defer s.Unlock()
+	l, ok := s.logs[from]
+	if !ok || from == to {
+		return
+	}
+	delete(s.logs, from)
+	if dest, ok := s.logs[to]; ok {
+		dest.merge(l)
+		return
+	}
+	s.logs[to] = l
+}
+
+func (s *clickStats) remove(name string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.logs, name)
+}
+
+// newClick describes the request r following a redirect at t.
+func newClick(r *http.Request, t int64) Click {
+	c := Click{Time: t, Host: hostName(r.Host), Agent: agentFamily(r.UserAgent())}
+	if ref := r.Referer(); ref != "" {
+		if u, err := url.Parse(ref); err == nil && u.Hostname() != "" {
+			c.Referrer = strings.ToLower(u.Hostname())
+		}
+	}
+	return c
+}
+
+// agentFamilies maps user-agent substrings to families, checked in order
+// since most browsers claim to be several others as well.
+var agentFamilies = []struct{ match, family string }{
+	{"bot", "bot"},
+	{"spider", "bot"},
+	{"crawl", "bot"},
+	{"curl/", "curl"},
+	{"wget/", "wget"},
+	{"go-http-client", "go"},
+	{"python", "python"},
+	{"edg/", "edge"},
+	{"opr/", "opera"},
+	{"firefox", "firefox"},
+	{"chrome", "chrome"},
+	{"chromium", "chrome"},
+	{"safari", "safari"},
+}
+
+// agentFamily reduces a user-agent string to the client family.
+func agentFamily(ua string) string {
+	if ua == "" {
+		return ""
+	}
+	ua = strings.ToLower(ua)
+	for _, f := range agentFamilies {
+		if strings.Contains(ua, f.match) {
+			return f.family
+		}
+	}
+	return "other"
+}
+
+// Point is the number of clicks in the hour or day starting at Start.
+type Point struct {
+	Start  int64
+	Clicks int
+}
+
+// Count is the number of clicks of a referrer or user-agent family.
+type Count struct {
+	Key    string
+	Clicks int
+}
+
+// ClickStats is the answer to a stats request, for a bookmark, the clicks
+// made through a host, or both.
+type ClickStats struct {
+	Name      string `json:",omitempty"`
+	Host      string `json:",omitempty"`
+	Total     int
+	Hourly    []Point
+	Daily     []Point
+	Referrers []Count
+	Agents    []Count
+}
+
+// top returns the n largest counts of m, ties broken by key.
+func top(m map[string]int, n int) []Count {
+	r := make([]Count, 0, len(m))
+	for k, v := range m {
+		r = append(r, Count{k, v})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Clicks != r[j].Clicks {
+			return r[i].Clicks > r[j].Clicks
+		}
+		return r[i].Key < r[j].Key
+	})
+	if len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
+
+// report summarises the clicks of the bookmarks whose names match, made
+// through host unless it is empty: hourly points for the last hours hours,
+// daily points for the last days days, and the topN referrers and user-agent
+// families over everything kept.
+func (s *clickStats) report(match func(string) bool, host string, now int64, hours, days, topN int) ClickStats {
+	s.Lock()
+	defer s.Unlock()
+	hourly := make(map[int64]int)
+	daily := make(map[int64]int)
+	all := &bucket{}
+	for name, l := range s.logs {
+		if !match(name) {
+			continue
+		}
+		for _, c := range l.Raw {
+			if host != "" && c.Host != host {
+				continue
+			}
+			all.add(c)
+			hourly[hourOf(c.Time)]++
+			daily[dayOf(c.Time)]++
+		}
+		for _, h := range l.Hours {
+			if host != "" && h.Host != host {
+				continue
+			}
+			all.merge(h)
+			hourly[h.Start] += h.Clicks
+			daily[dayOf(h.Start)] += h.Clicks
+		}
+		for _, d := range l.Days {
+			if host != "" && d.Host != host {
+				continue
+			}
+			all.merge(d)
+			daily[d.Start] += d.Clicks
+		}
+	}
+	return ClickStats{
+		Total:     all.Clicks,
+		Hourly:    series(hourly, hourOf(now), 3600, hours),
+		Daily:     series(daily, dayOf(now), 86400, days),
+		Referrers: top(all.Referrers, topN),
+		Agents:    top(all.Agents, topN),
+	}
+}
+
+// series returns n points of width step ending with the one starting at
+// last, oldest first; periods without clicks are included as zero.
+func series(counts map[int64]int, last, step int64, n int) []Point {
+	r := make([]Point, n)
+	for i := range r {
+		start := last - int64(n-1-i)*step
+		r[i] = Point{start, counts[start]}
+	}
+	return r
+}
+
+func (app *application) loadStats() {
+	file, err := os.Open(statsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			app.errorLog.Println(err)
+		}
+		return
+	}
+	defer file.Close()
+	app.stats.Lock()
+	defer app.stats.Unlock()
+	if err = json.NewDecoder(file).Decode(&app.stats.logs); err != nil {
+		app.errorLog.Println("failed to decode click stats", err)
+	}
+}
+
+func (app *application) saveStats() error {
+	file, err := os.Create(statsFile)
+	if err != nil {
+		app.errorLog.Println(err)
+		return err
+	}
+	defer file.Close()
+	app.stats.Lock()
+	defer app.stats.Unlock()
+	return json.NewEncoder(file).Encode(app.stats.logs)
+}
+
+// statsParam parses the non-negative integer query parameter key of r,
+// returning def if it is absent.
+func statsParam(r *http.Request, key string, def, max int) (int, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > max {
+		return 0, FieldError{key, fmt.Sprintf("must be a number between 0 and %d", max)}
+	}
+	return n, nil
+}
+
+// clickStats answers GET /api/v1/stats/{name} with the redirect clicks of a
+// bookmark, and GET /api/v1/stats/ with those of all bookmarks made through
+// a host, by default the one addressed. host also narrows the clicks of a
+// bookmark to one host. hours and days set the length of the hourly and
+// daily series, top the number of referrers and user-agent families listed.
+func (app *application) clickStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/stats/")
+	host := hostName(r.URL.Query().Get("host"))
+	if name != "" {
+		if _, ok := nameIndex[name]; !ok {
+			app.notFound(w, r, name)
+			return
+		}
+	} else if host == "" {
+		host = hostName(r.Host)
+	}
+	var errs ValidationError
+	hours, err := statsParam(r, "hours", defaultStatsHours, int(hourRetention/time.Hour))
+	errs.add("hours", err)
+	days, err := statsParam(r, "days", defaultStatsDays, maxStatsDays)
+	errs.add("days", err)
+	topN, err := statsParam(r, "top", defaultTopN, maxTopN)
+	errs.add("top", err)
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
+	match := func(n string) bool { return name == "" || n == name }
+	report := app.stats.report(match, host, time.Now().Unix(), hours, days, topN)
+	report.Name, report.Host = name, host
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		app.errorLog.Printf("encoding error: %s\n", err.Error())
+	}
+}
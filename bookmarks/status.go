@@ -0,0 +1,53 @@
+package bookmarks
+
+import "sort"
+
+// Reading-list states a bookmark can be in.
+const (
+	StatusUnread   = "unread"
+	StatusReading  = "reading"
+	StatusDone     = "done"
+	StatusArchived = "archived"
+)
+
+// ValidStatus reports whether s is one of the known reading-list states.
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusUnread, StatusReading, StatusDone, StatusArchived:
+		return true
+	}
+	return false
+}
+
+// State returns the reading-list state of the bookmark. Records created
+// before states were introduced are treated as unread.
+func (b *Bookmark) State() string {
+	if b.Status == "" {
+		return StatusUnread
+	}
+	return b.Status
+}
+
+// stateOrder ranks the reading-list states in the order a bookmark moves
+// through them.
+var stateOrder = map[string]int{
+	StatusUnread:   0,
+	StatusReading:  1,
+	StatusDone:     2,
+	StatusArchived: 3,
+}
+
+// sortReadingList orders list as a reading list: pinned entries first, then
+// by state, then oldest first.
+func sortReadingList(list []*Bookmark) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if sa, sb := stateOrder[a.State()], stateOrder[b.State()]; sa != sb {
+			return sa < sb
+		}
+		return a.Created < b.Created
+	})
+}
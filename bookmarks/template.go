@@ -0,0 +1,213 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A template URL contains placeholders filled in when it is followed:
+//
+//	https://jira.example.com/browse/{1}
+//	https://grafana.example.com/d/{dash=overview}?from={from=now-6h}
+//
+// {1}, {2}, ... take the path segments after the name, as in
+// /go/jira/OPS-123, and named placeholders take query parameters. Either
+// kind may give a default after '='. Query parameters no placeholder uses
+// are passed through to the expanded URL.
+
+var placeholderRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// placeholder is a {name} or {name=default} part of a template.
+type placeholder struct {
+	start, end int // byte offsets of the braces in the template
+	name       string
+	def        string
+	hasDef     bool
+}
+
+// IsTemplate reports whether raw contains placeholders.
+func IsTemplate(raw string) bool {
+	return strings.ContainsAny(raw, "{}")
+}
+
+// placeholders returns the placeholders of tmpl in order.
+func placeholders(tmpl string) ([]placeholder, error) {
+	var r []placeholder
+	for i := 0; i < len(tmpl); i++ {
+		switch tmpl[i] {
+		case '}':
+			return nil, fmt.Errorf("unmatched '}' at %d", i)
+		case '{':
+			end := strings.IndexAny(tmpl[i+1:], "{}")
+			if end < 0 || tmpl[i+1+end] != '}' {
+				return nil, fmt.Errorf("unterminated placeholder at %d", i)
+			}
+			end += i + 1
+			p := placeholder{start: i, end: end, name: tmpl[i+1 : end]}
+			if eq := strings.IndexByte(p.name, '='); eq >= 0 {
+				p.name, p.def, p.hasDef = p.name[:eq], p.name[eq+1:], true
+			}
+			if !placeholderRe.MatchString(p.name) {
+				return nil, fmt.Errorf("invalid placeholder %q", tmpl[i:end+1])
+			}
+			if n, err := strconv.Atoi(p.name); err == nil && n < 1 {
+				return nil, fmt.Errorf("positional placeholders start at {1}")
+			}
+			r = append(r, p)
+			i = end
+		}
+	}
+	return r, nil
+}
+
+// validateTemplate checks the placeholders of tmpl and returns it with every
+// placeholder replaced by a sample value, for validating the rest as a URL.
+func validateTemplate(tmpl string) (string, error) {
+	ps, err := placeholders(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	last := 0
+	for _, p := range ps {
+		b.WriteString(tmpl[last:p.start])
+		b.WriteString("x")
+		last = p.end + 1
+	}
+	b.WriteString(tmpl[last:])
+	return b.String(), nil
+}
+
+// Expand fills in the placeholders of tmpl from args and query, and appends
+// the query parameters no placeholder used. Plain URLs get args appended to
+// their path instead.
+func Expand(tmpl string, args []string, query url.Values) (string, error) {
+	ps, err := placeholders(tmpl)
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool)
+	var b strings.Builder
+	last := 0
+	maxArg := 0
+	for _, p := range ps {
+		var value string
+		var ok bool
+		if n, err := strconv.Atoi(p.name); err == nil {
+			if n > maxArg {
+				maxArg = n
+			}
+			if n <= len(args) {
+				value, ok = args[n-1], true
+			}
+		} else if _, ok = query[p.name]; ok {
+			value = query.Get(p.name)
+			used[p.name] = true
+		}
+		if !ok {
+			if !p.hasDef {
+				return "", fmt.Errorf("missing argument {%s}", p.name)
+			}
+			value = p.def
+		}
+		b.WriteString(tmpl[last:p.start])
+		if strings.Contains(tmpl[:p.start], "?") {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = p.end + 1
+	}
+	b.WriteString(tmpl[last:])
+	expanded := b.String()
+	if len(ps) == 0 && len(args) > 0 {
+		escaped := make([]string, len(args))
+		for i, a := range args {
+			escaped[i] = url.PathEscape(a)
+		}
+		expanded = appendPath(expanded, strings.Join(escaped, "/"))
+	} else if len(args) > maxArg {
+		return "", fmt.Errorf("too many arguments: want %d, got %d", maxArg, len(args))
+	}
+	extra := make(url.Values)
+	for k, v := range query {
+		if !used[k] {
+			extra[k] = v
+		}
+	}
+	if len(extra) > 0 {
+		sep := "?"
+		if strings.Contains(expanded, "?") {
+			sep = "&"
+		}
+		frag := ""
+		if i := strings.IndexByte(expanded, '#'); i >= 0 {
+			expanded, frag = expanded[:i], expanded[i:]
+		}
+		expanded += sep + extra.Encode() + frag
+	}
+	return expanded, nil
+}
+
+// appendPath adds path below the path of raw, before its query and fragment.
+func appendPath(raw, path string) string {
+	rest := ""
+	if i := strings.IndexAny(raw, "?#"); i >= 0 {
+		raw, rest = raw[:i], raw[i:]
+	}
+	return strings.TrimSuffix(raw, "/") + "/" + path + rest
+}
+
+// splitGoPath splits the path of a go-link into the name and its arguments.
+func splitGoPath(path string) (string, []string) {
+	parts := strings.Split(path, "/")
+	var args []string
+	for _, a := range parts[1:] {
+		if a != "" {
+			args = append(args, a)
+		}
+	}
+	return parts[0], args
+}
+
+// preview answers /api/v1/preview/{name}/{args...}?query with the URL the
+// go-link would redirect to, without counting a visit.
+func (app *application) preview(w http.ResponseWriter, r *http.Request) {
+	name, args := app.goName(r, strings.TrimPrefix(r.URL.Path, "/api/v1/preview/"))
+	b, ok := nameIndex[name]
+	if !ok || !live(b, false) || !app.resolvable(r, b) {
+		app.notFound(w, r, name)
+		return
+	}
+	b, err := resolve(b)
+	if err != nil {
+		badRequest(w, FieldError{"name", err.Error()})
+		return
+	}
+	if !live(b, false) || !app.resolvable(r, b) {
+		app.notFound(w, r, name)
+		return
+	}
+	target, err := expandFor(r, b, args)
+	if err != nil {
+		if _, ok := err.(FieldError); !ok {
+			err = FieldError{"args", err.Error()}
+		}
+		badRequest(w, err)
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(struct {
+		Name     string
+		Template string
+		URL      string
+	}{name, b.URL, target}); err != nil {
+		app.errorLog.Printf("encoding error: %s\n", err.Error())
+	}
+}
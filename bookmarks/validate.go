@@ -0,0 +1,219 @@
+package bookmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Limits applied to user supplied bookmark data.
+const (
+	MaxNameLength = 64
+	MaxTagLength  = 32
+	MaxTags       = 20
+)
+
+// AllowedSchemes lists the URL schemes a bookmark may point to.
+var AllowedSchemes = []string{"http", "https", "ftp"}
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError collects every field error found in one input.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// add records a field error, flattening nested validation errors.
+func (e *ValidationError) add(field string, err error) {
+	switch v := err.(type) {
+	case nil:
+	case ValidationError:
+		*e = append(*e, v...)
+	case FieldError:
+		*e = append(*e, v)
+	default:
+		*e = append(*e, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// err returns e as an error, or nil when no field was rejected.
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// reservedNames are the routes under /api/v1/ that a bookmark or namespace
+// of the same name would shadow in /api/v1/{name}.
+var reservedNames = map[string]bool{
+	"complete": true, "create": true, "dedupe": true, "delete": true,
+	"dump": true, "duplicates": true, "find": true, "preview": true,
+	"qr": true, "save": true, "schema": true, "search": true,
+	"shorten": true, "smart": true, "stats": true, "status": true,
+	"suggest": true, "tags": true,
+}
+
+// reserved reports whether name, or its namespace, is taken by a route.
+func reserved(name string) bool {
+	return reservedNames[strings.ToLower(strings.SplitN(name, "/", 2)[0])]
+}
+
+// ValidateName checks that name can be used as a path segment, e.g. in
+// /api/v1/delete/{name}, optionally after the namespace of a virtual host
+// and a '/'. Names of API routes are reserved.
+func ValidateName(name string) error {
+	parts := strings.Split(name, "/")
+	switch {
+	case name == "":
+		return FieldError{"name", "must not be empty"}
+	case len(name) > MaxNameLength:
+		return FieldError{"name", fmt.Sprintf("must be at most %d characters", MaxNameLength)}
+	case len(parts) > 2:
+		return FieldError{"name", "must contain at most one '/', after the namespace"}
+	}
+	for _, p := range parts {
+		if !nameRe.MatchString(p) {
+			return FieldError{"name", "must start with a letter or digit and contain only letters, digits, '.', '_' and '-'"}
+		}
+	}
+	if reserved(name) {
+		return FieldError{"name", parts[0] + " is reserved for the API"}
+	}
+	if len(parts) == 2 && !namespaces[parts[0]] {
+		return FieldError{"name", parts[0] + " is not the namespace of any host"}
+	}
+	return nil
+}
+
+// ValidateURL checks that raw is an absolute URL with an allowed scheme.
+// Template URLs are checked with their placeholders filled in.
+func ValidateURL(raw string) error {
+	if IsTemplate(raw) {
+		sample, err := validateTemplate(raw)
+		if err != nil {
+			return FieldError{"url", err.Error()}
+		}
+		raw = sample
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return FieldError{"url", "is not a valid url"}
+	}
+	scheme := strings.ToLower(u.Scheme)
+	allowed := false
+	for _, s := range AllowedSchemes {
+		if s == scheme {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return FieldError{"url", fmt.Sprintf("scheme %q is not one of %s", u.Scheme, strings.Join(AllowedSchemes, ","))}
+	}
+	if u.Host == "" {
+		return FieldError{"url", "must include a host"}
+	}
+	return nil
+}
+
+// NormalizeTags trims, lowercases and deduplicates tags, dropping empty ones
+// and preserving the original order.
+func NormalizeTags(tags []string) ([]string, error) {
+	r := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > MaxTagLength {
+			return nil, FieldError{"tags", fmt.Sprintf("%q is longer than %d characters", t, MaxTagLength)}
+		}
+		if strings.ContainsAny(t, " \t\n/") {
+			return nil, FieldError{"tags", fmt.Sprintf("%q must not contain whitespace or '/'", t)}
+		}
+		seen[t] = true
+		r = append(r, t)
+	}
+	if len(r) > MaxTags {
+		return nil, FieldError{"tags", fmt.Sprintf("at most %d tags are allowed", MaxTags)}
+	}
+	return r, nil
+}
+
+// SplitTags splits a comma separated tag list and normalizes it.
+func SplitTags(s string) ([]string, error) {
+	return NormalizeTags(strings.Split(s, ","))
+}
+
+// Normalize validates the bookmark in place, trimming its name and URL and
+// normalizing its tags. Aliases must name their target instead of a URL.
+// All problems are reported together as a ValidationError.
+func (b *Bookmark) Normalize() error {
+	var errs ValidationError
+	b.Name = strings.TrimSpace(b.Name)
+	b.URL = strings.TrimSpace(b.URL)
+	b.Alias = strings.TrimSpace(b.Alias)
+	errs.add("name", ValidateName(b.Name))
+	if b.Alias != "" {
+		if b.URL != "" {
+			errs.add("url", FieldError{"url", "aliases must not have a url"})
+		}
+		if err := ValidateName(b.Alias); err != nil {
+			errs.add("alias", FieldError{"alias", err.(FieldError).Message})
+		}
+		if len(b.Envs) > 0 {
+			errs.add("alias", FieldError{"alias", "aliases follow the environments of their target"})
+		}
+		if b.Protected || b.ClicksLeft != nil {
+			errs.add("alias", FieldError{"alias", "aliases follow the password and click limit of their target"})
+		}
+	} else {
+		errs.add("url", ValidateURL(b.URL))
+	}
+	errs.add("", validateEnvs(b.Envs))
+	tags, err := NormalizeTags(b.Tags)
+	errs.add("tags", err)
+	if err == nil {
+		b.Tags = tags
+	}
+	if b.Status != "" && !ValidStatus(b.Status) {
+		errs.add("status", FieldError{"status", fmt.Sprintf("%q is not a valid status", b.Status)})
+	}
+	if b.Visibility != "" && !ValidVisibility(b.Visibility) {
+		errs.add("visibility", FieldError{"visibility", fmt.Sprintf("%q is not a valid visibility", b.Visibility)})
+	}
+	return errs.err()
+}
+
+// badRequest reports err to the client as a JSON list of field errors. Errors
+// that are not tied to a field carry an empty field name.
+func badRequest(w http.ResponseWriter, err error) {
+	var errs ValidationError
+	errs.add("", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Errors ValidationError `json:"errors"`
+	}{errs})
+}
@@ -0,0 +1,37 @@
+package bookmarks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	namespaces = map[string]bool{"docs": true}
+	t.Cleanup(func() { namespaces = make(map[string]bool) })
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"gh", ""},
+		{"docs/wiki", ""},
+		{"search-tips", ""},
+		{"docs/search", ""},
+		{"", "must not be empty"},
+		{strings.Repeat("a", MaxNameLength+1), "must be at most"},
+		{"a/b/c", "at most one '/'"},
+		{"-gh", "must start with a letter or digit"},
+		{"wiki/home", "wiki is not the namespace of any host"},
+		{"search", "search is reserved for the API"},
+		{"Tags", "Tags is reserved for the API"},
+		{"smart/x", "smart is reserved for the API"},
+	}
+	for _, tt := range tests {
+		err := ValidateName(tt.name)
+		switch {
+		case tt.msg == "" && err != nil:
+			t.Errorf("ValidateName(%q) = %v, want nil", tt.name, err)
+		case tt.msg != "" && (err == nil || !strings.Contains(err.Error(), tt.msg)):
+			t.Errorf("ValidateName(%q) = %v, want %q", tt.name, err, tt.msg)
+		}
+	}
+}
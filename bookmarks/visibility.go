@@ -0,0 +1,123 @@
+package bookmarks
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Visibility levels of a bookmark. Private entries are only shown to
+// authenticated clients, unlisted ones resolve by exact name for everyone but
+// are left out of anonymous listings, and public ones are shown to everyone.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+// ValidVisibility reports whether v is a known visibility level.
+func ValidVisibility(v string) bool {
+	switch v {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// Access returns the visibility of the bookmark, defaulting to private.
+func (b *Bookmark) Access() string {
+	if b.Visibility == "" {
+		return VisibilityPrivate
+	}
+	return b.Visibility
+}
+
+// RequireToken sets the bearer token that identifies authenticated clients.
+func (app *application) RequireToken(token string) {
+	app.token = token
+}
+
+// TrustLoopback makes requests from the loopback interface authenticated
+// without a token. It is off by default, as behind a reverse proxy on the
+// same machine every request comes from the loopback interface.
+func (app *application) TrustLoopback(trust bool) {
+	app.trustLoopback = trust
+}
+
+// authenticated reports whether r comes from the owner of the collection.
+// Until the owner can be told apart, by a token or a trusted loopback
+// interface, every request is the owner's.
+func (app *application) authenticated(r *http.Request) bool {
+	if app.token == "" && !app.trustLoopback {
+		return true
+	}
+	if app.token != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(app.token)) == 1 {
+			return true
+		}
+	}
+	if !app.trustLoopback {
+		return false
+	}
+	ip := net.ParseIP(clientIP(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// Password protected bookmarks are treated as private outside their redirect,
+// so their URL is only handed out once the password is given. On virtual
+// hosts, listings are further limited to the namespace of the host.
+
+// listable filters list down to the entries r may see in a listing.
+func (app *application) listable(r *http.Request, list []*Bookmark) []*Bookmark {
+	ns, vhost := app.virtualHost(r)
+	auth := app.authenticated(r)
+	if auth && !vhost {
+		return list
+	}
+	res := make([]*Bookmark, 0, len(list))
+	for _, b := range list {
+		if (auth || public(b)) && (!vhost || inNamespace(ns, b)) {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+// listed reports whether r may see b in a listing.
+func (app *application) listed(r *http.Request, b *Bookmark) bool {
+	if ns, ok := app.virtualHost(r); ok && !inNamespace(ns, b) {
+		return false
+	}
+	return public(b) || app.authenticated(r)
+}
+
+// public reports whether anyone may see b in a listing.
+func public(b *Bookmark) bool {
+	return b.Access() == VisibilityPublic && !b.Protected
+}
+
+// resolvable reports whether r may look b up by its exact name.
+func (app *application) resolvable(r *http.Request, b *Bookmark) bool {
+	return (b.Access() != VisibilityPrivate && !b.Protected) || app.authenticated(r)
+}
+
+// followable reports whether r may follow the redirect of b, subject to its
+// password if it has one.
+func (app *application) followable(r *http.Request, b *Bookmark) bool {
+	return b.Access() != VisibilityPrivate || app.authenticated(r)
+}
+
+// authOnly rejects anonymous requests to endpoints that modify the
+// collection or report on all of it, private entries included.
+func (app *application) authOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.authenticated(r) {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package bookmarks
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// inTempDir runs the rest of the test in a fresh directory, as saving the
+// collection writes its files to the working directory.
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestVisibilityAccess(t *testing.T) {
+	inTempDir(t)
+	tests := []struct {
+		token  string
+		auth   bool
+		method string
+		target string
+		want   int
+	}{
+		// without a token every request is the owner's
+		{"", false, http.MethodPost, "/api/v1/create", http.StatusOK},
+		{"", false, http.MethodGet, "/api/v1/find?name=gh", http.StatusOK},
+		{"", false, http.MethodGet, "/go/gh", http.StatusFound},
+		{"", false, http.MethodGet, "/api/v1/stats/", http.StatusOK},
+		{"", false, http.MethodGet, "/api/v1/duplicates", http.StatusOK},
+		// with one, anonymous requests neither see nor change private entries
+		{testToken, false, http.MethodPost, "/api/v1/create", http.StatusUnauthorized},
+		{testToken, false, http.MethodGet, "/api/v1/find?name=gh", http.StatusNotFound},
+		{testToken, false, http.MethodGet, "/go/gh", http.StatusNotFound},
+		{testToken, false, http.MethodPut, "/api/v1/gh", http.StatusUnauthorized},
+		{testToken, false, http.MethodGet, "/api/v1/stats/", http.StatusUnauthorized},
+		{testToken, true, http.MethodPost, "/api/v1/create", http.StatusOK},
+		{testToken, true, http.MethodGet, "/api/v1/find?name=gh", http.StatusOK},
+		{testToken, true, http.MethodGet, "/go/gh", http.StatusFound},
+		{testToken, true, http.MethodGet, "/api/v1/stats/", http.StatusOK},
+	}
+	for _, tt := range tests {
+		d := NewDB()
+		d.rebuildIndex()
+		app := NewApp(log.New(io.Discard, "", 0), log.New(io.Discard, "", 0), &d)
+		app.RequireToken(tt.token)
+		mux := app.Routes()
+		create := url.Values{"name": {"gh"}, "url": {"https://github.com"}, "tags": {"code"}}
+		if tt.target != "/api/v1/create" {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/create", strings.NewReader(create.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			mux.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		var body io.Reader
+		switch tt.method {
+		case http.MethodPost:
+			body = strings.NewReader(create.Encode())
+		case http.MethodPut:
+			body = strings.NewReader("visibility=public")
+		}
+		r := httptest.NewRequest(tt.method, tt.target, body)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.auth {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("token %q, auth=%t: %s %s = %d, want %d", tt.token, tt.auth, tt.method, tt.target, w.Code, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,8 +17,16 @@ type application struct {
 	infoLog  *log.Logger
 	errorLog *log.Logger
 	db       *db
+	schema   Schema
+	smart    Smart
+	stats    *clickStats
+	attempts *limiter
+	hosts    Hosts
+	token    string
 	sync     chan int
 	numSaved int
+
+	trustLoopback bool
 }
 
 func NewApp(info, err *log.Logger, d *db) *application {
@@ -26,6 +35,11 @@ func NewApp(info, err *log.Logger, d *db) *application {
 		infoLog:  info,
 		errorLog: err,
 		db:       d,
+		schema:   make(Schema),
+		smart:    make(Smart),
+		stats:    newClickStats(),
+		attempts: newLimiter(),
+		hosts:    make(Hosts),
 		sync:     c,
 		numSaved: 0,
 	}
@@ -36,34 +50,67 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	enc := json.NewEncoder(w)
-	if err := enc.Encode(app.db); err != nil {
+	filter, err := parseListFilter(r.URL.Query(), app.schema)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	list := make([]*Bookmark, 0, len(*app.db))
+	for _, b := range app.listable(r, *app.db) {
+		if filter.match(b) {
+			list = append(list, b)
+		}
+	}
+	if p.order.key == "" {
+		sortReadingList(list)
+	}
+	list, next := p.apply(list)
+	if err := p.write(w, list, next); err != nil {
 		app.errorLog.Printf("encoding error: %s\n", err.Error())
 		fmt.Fprintf(w, "%s", err.Error())
 	}
 }
 
 func (app *application) getBookmarkByTag(w http.ResponseWriter, r *http.Request) {
-	tag := strings.TrimPrefix(r.URL.Path, "/api/v1/tags/")
+	tag := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/api/v1/tags/"))
 	if tag == "" {
 		http.Error(w, "Missing Tag name", http.StatusBadRequest)
 		return
 	}
-	result, ok := tagIndex[tag]
-	if !ok {
+	result := app.listable(r, visible(tagIndex[tag], includeExpired(r)))
+	if len(result) == 0 {
 		http.Error(w, fmt.Sprintf("%s: No such tag", tag), http.StatusNotFound)
 		app.errorLog.Printf("%s: no such tag\n", tag)
 		return
 	}
+	filter, err := parseListFilter(r.URL.Query(), app.schema)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	result, next := p.apply(filter.apply(result))
 	for _, r := range result {
 		r.Update()
 	}
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
 
 	var buf bytes.Buffer
 
 	mw := io.MultiWriter(w, &buf)
 	enc := json.NewEncoder(mw)
-	if err := enc.Encode(result); err != nil {
+	if err := enc.Encode(p.project(result)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -74,8 +121,11 @@ func (app *application) getTags(w http.ResponseWriter, r *http.Request) {
 	var buf bytes.Buffer
 	response := make([]string, 0)
 
-	for t := range tagIndex {
-		response = append(response, t)
+	expired := includeExpired(r)
+	for t, b := range tagIndex {
+		if len(app.listable(r, visible(b, expired))) > 0 {
+			response = append(response, t)
+		}
 	}
 	mw := io.MultiWriter(w, &buf)
 	enc := json.NewEncoder(mw)
@@ -90,20 +140,44 @@ func (app *application) getTags(w http.ResponseWriter, r *http.Request) {
 func (app *application) find(w http.ResponseWriter, r *http.Request) {
 	var index = make(map[string]struct{})
 	name := r.URL.Query().Get("name")
-	enc := json.NewEncoder(w)
 	var ok, valid bool
 	var q *Bookmark
+	expired := includeExpired(r)
+	now := time.Now().Unix()
+	filter, err := parseListFilter(r.URL.Query(), app.schema)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	p, err := parsePage(r.URL.Query())
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if name != "" && r.URL.Query().Get("fuzzy") == "1" {
+		app.fuzzyFind(w, r, name, filter)
+		return
+	}
 	if name != "" {
-		if _, ok = nameIndex[name]; !ok {
-			http.Error(w, fmt.Sprintf("%s: not found", name), http.StatusNotFound)
+		if q, ok = nameIndex[name]; !ok || (!expired && q.Expired(now)) || !app.resolvable(r, q) {
+			app.notFound(w, r, name)
 			return
 		}
+		// aliases are looked up as the bookmark they end at; broken chains
+		// return the alias itself so it can be inspected and fixed
+		if dest, err := resolve(q); err == nil {
+			if !app.resolvable(r, dest) {
+				app.notFound(w, r, name)
+				return
+			}
+			q = dest
+		}
 		valid = true
-		index[name] = struct{}{}
+		index[q.Name] = struct{}{}
 	}
 	url := r.URL.Query().Get("url")
 	if url != "" {
-		if q, ok = urlIndex[url]; !ok {
+		if q, ok = urlIndex[Canonical(url)]; !ok || (!expired && q.Expired(now)) || !app.listed(r, q) {
 			http.Error(w, fmt.Sprintf("%s: not found", url), http.StatusNotFound)
 			return
 		}
@@ -117,30 +191,55 @@ func (app *application) find(w http.ResponseWriter, r *http.Request) {
 	if tag != "" {
 		tags = strings.Split(tag, ",")
 		for _, _tag := range tags {
-			if _, ok = tagIndex[_tag]; !ok {
+			_tag = strings.ToLower(strings.TrimSpace(_tag))
+			result := app.listable(r, visible(tagIndex[_tag], expired))
+			if len(result) == 0 {
 				http.Error(w, fmt.Sprintf("%s: not found", _tag), http.StatusNotFound)
 				return
 			}
-			for _, e := range tagIndex[_tag] {
+			for _, e := range result {
 				index[e.Name] = struct{}{}
 				tagMap[_tag] = true
 			}
 		}
 		valid = true
 	}
+	if query := r.URL.Query().Get("q"); query != "" {
+		result, err := app.db.Query(query)
+		if err != nil {
+			badRequest(w, FieldError{"q", err.Error()})
+			return
+		}
+		for _, b := range app.listable(r, visible(result, expired)) {
+			index[b.Name] = struct{}{}
+		}
+		valid = true
+	}
+	if !valid && !filter.empty() {
+		for _, b := range app.listable(r, visible(*app.db, expired)) {
+			index[b.Name] = struct{}{}
+		}
+		valid = true
+	}
 	if !valid {
-		http.Error(w, "One of url, tag, name param missing", http.StatusBadRequest)
+		http.Error(w, "One of url, tag, name, q or a filter param missing", http.StatusBadRequest)
 	} else {
 		var r = make([]*Bookmark, 0)
 		for b := range index {
+			if !filter.match(nameIndex[b]) {
+				continue
+			}
 			r = append(r, nameIndex[b])
-			for _, t := range nameIndex[b].Tags {
+		}
+		r, next := p.apply(r)
+		for _, b := range r {
+			for _, t := range b.Tags {
 				if _, ok := tagMap[t]; ok {
-					nameIndex[b].Update()
+					b.Update()
 				}
 			}
 		}
-		enc.Encode(r)
+		p.write(w, r, next)
 	}
 }
 
@@ -151,30 +250,93 @@ func (app *application) createBookmark(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
 		return
 	}
-	var name, url string
-	var tags = make([]string, 0)
+	var errs ValidationError
+	alias := r.FormValue("alias")
 	for _, param := range paramsExpected {
-		if r.FormValue(param) == "" {
-			http.Error(w, fmt.Sprintf("missing param %s", param), http.StatusBadRequest)
-			return
+		// aliases name their target instead of a url
+		if r.FormValue(param) == "" && (param != "url" || alias == "") {
+			errs.add(param, FieldError{param, "missing param"})
 		}
 	}
-	name = r.FormValue("name")
-	url = r.FormValue("url")
-	for _, s := range strings.Split(r.FormValue("tags"), ",") {
-		tags = append(tags, strings.TrimSpace(s))
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
+	bk := NewBookmark(r.FormValue("name"), r.FormValue("url"), strings.Split(r.FormValue("tags"), ","))
+	bk.Alias = alias
+	if v := r.FormValue("visibility"); v != "" {
+		bk.Visibility = v
 	}
-	bk := NewBookmark(name, url, tags)
+	bk.Title = strings.TrimSpace(r.FormValue("title"))
+	bk.Notes = strings.TrimSpace(r.FormValue("notes"))
+	bk.Creator = strings.TrimSpace(r.FormValue("creator"))
+	if envs := envValues(r.Form); len(envs) > 0 {
+		bk.Envs = envs
+	}
+	errs.add("password", bk.SetPassword(r.FormValue("password")))
+	if v := r.FormValue("max_clicks"); v != "" {
+		left, err := parseMaxClicks(v)
+		errs.add("max_clicks", err)
+		bk.ClicksLeft = left
+	}
+	errs.add("", bk.Normalize())
+	if bk.IsAlias() && len(errs) == 0 {
+		errs.add("alias", checkAlias(bk.Name, bk.Alias))
+	}
+	expires, err := parseExpiry(r.FormValue("expires"), r.FormValue("ttl"), time.Now())
+	errs.add("expires", err)
+	fields, err := app.schema.Validate(fieldValues(r.Form), true)
+	errs.add("", err)
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
+	bk.Expires = expires
+	if len(fields) > 0 {
+		bk.Fields = fields
+	}
+	dup := app.db.FindURL(bk.URL)
 	if err := app.db.Add(bk); err != nil {
 		app.errorLog.Printf("failed to create bookmark %s: %s\n", bk, err)
 		fmt.Fprintf(w, "%s", err)
 	} else {
 		app.infoLog.Printf("created: %s", bk)
 		fmt.Fprintf(w, "created %s", bk.Name)
+		if dup != nil {
+			app.infoLog.Printf("%s duplicates %s\n", bk.Name, dup.Name)
+			fmt.Fprintf(w, " (warning: same url as %s)", dup.Name)
+		}
 		app.Save()
 	}
 }
 
+// includeExpired reports whether the request asked for expired and archived
+// bookmarks to be included in the response.
+func includeExpired(r *http.Request) bool {
+	return r.URL.Query().Get("include_expired") == "1"
+}
+
+// live reports whether b should be shown, i.e. it has not expired or expired
+// entries were asked for.
+func live(b *Bookmark, expired bool) bool {
+	return expired || !b.Expired(time.Now().Unix())
+}
+
+// visible filters out expired bookmarks unless expired is set.
+func visible(list []*Bookmark, expired bool) []*Bookmark {
+	if expired {
+		return list
+	}
+	now := time.Now().Unix()
+	r := make([]*Bookmark, 0, len(list))
+	for _, b := range list {
+		if !b.Expired(now) {
+			r = append(r, b)
+		}
+	}
+	return r
+}
+
 func jsonMiddleware(log *log.Logger, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-type", "application/json")
@@ -184,20 +346,42 @@ func jsonMiddleware(log *log.Logger, next http.HandlerFunc) http.HandlerFunc {
 
 func (app *application) Routes() *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", app.home)
+	mux.HandleFunc("/", app.root)
+	mux.HandleFunc("/go/", app.redirect("/go/"))
+	mux.HandleFunc("/opensearch.xml", app.openSearch("/go/"))
+	mux.HandleFunc("/api/v1/suggest", app.openSearchSuggest("/go/"))
 	mux.HandleFunc("/api/v1/tags", jsonMiddleware(app.infoLog, app.getTags))
 	mux.HandleFunc("/api/v1/tags/", jsonMiddleware(app.infoLog, app.getBookmarkByTag))
 	mux.HandleFunc("/api/v1/find", jsonMiddleware(app.infoLog, app.find))
-	mux.HandleFunc("/api/v1/create", app.createBookmark)
-	mux.HandleFunc("/api/v1/save", app.Sync)
+	mux.HandleFunc("/api/v1/create", app.authOnly(app.createBookmark))
+	mux.HandleFunc("/api/v1/shorten", jsonMiddleware(app.infoLog, app.authOnly(app.shorten)))
+	mux.HandleFunc("/api/v1/save", app.authOnly(app.Sync))
 	mux.HandleFunc("/api/v1/dump", app.Dump)
-	mux.HandleFunc("/api/v1/delete/", jsonMiddleware(app.infoLog, app.Delete))
-	mux.HandleFunc("/api/v1/", jsonMiddleware(app.infoLog, app.Update))
+	mux.HandleFunc("/api/v1/delete/", jsonMiddleware(app.infoLog, app.authOnly(app.Delete)))
+	mux.HandleFunc("/api/v1/status/", jsonMiddleware(app.infoLog, app.authOnly(app.setStatus)))
+	mux.HandleFunc("/api/v1/qr/", app.qr)
+	mux.HandleFunc("/api/v1/preview/", jsonMiddleware(app.infoLog, app.preview))
+	mux.HandleFunc("/api/v1/stats/", jsonMiddleware(app.infoLog, app.authOnly(app.clickStats)))
+	mux.HandleFunc("/api/v1/complete", jsonMiddleware(app.infoLog, app.complete))
+	mux.HandleFunc("/api/v1/search", jsonMiddleware(app.infoLog, app.search))
+	mux.HandleFunc("/api/v1/duplicates", jsonMiddleware(app.infoLog, app.authOnly(app.duplicates)))
+	mux.HandleFunc("/api/v1/dedupe", jsonMiddleware(app.infoLog, app.authOnly(app.dedupe)))
+	mux.HandleFunc("/api/v1/schema", jsonMiddleware(app.infoLog, app.authOnly(app.Schema)))
+	mux.HandleFunc("/api/v1/schema/", jsonMiddleware(app.infoLog, app.authOnly(app.Schema)))
+	mux.HandleFunc("/api/v1/smart", jsonMiddleware(app.infoLog, app.smartCollections))
+	mux.HandleFunc("/api/v1/smart/", jsonMiddleware(app.infoLog, app.smartCollections))
+	mux.HandleFunc("/api/v1/", jsonMiddleware(app.infoLog, app.authOnly(app.Update)))
 	return mux
 }
 
 func (app *application) Dump(w http.ResponseWriter, r *http.Request) {
-	b := app.db.Dump()
+	all := app.db.Dump()
+	b := make([]Bookmark, 0, len(all))
+	for i := range all {
+		if app.listed(r, &all[i]) {
+			b = append(b, all[i])
+		}
+	}
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(b); err != nil {
 		fmt.Fprintf(w, "%v", err)
@@ -211,7 +395,7 @@ func (app *application) Update(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid method", http.StatusBadRequest)
 		return
 	}
-	paramsExpected := []string{"name", "url", "tags"}
+	paramsExpected := []string{"name", "url", "alias", "tags", "visibility", "title", "notes", "password", "remove_password", "max_clicks"}
 	name := strings.TrimPrefix(r.URL.Path, "/api/v1/")
 	if name == "" {
 		http.Error(w, "missing name", http.StatusBadRequest)
@@ -224,7 +408,49 @@ func (app *application) Update(w http.ResponseWriter, r *http.Request) {
 		app.errorLog.Printf("%s: Not found", name)
 		return
 	}
+	r.ParseForm()
+	var errs ValidationError
+	raw := fieldValues(r.Form)
+	fields, err := app.schema.Validate(raw, false)
+	errs.add("", err)
 	app.infoLog.Printf("update: %s, %s\n", name, (*app.db)[idx])
+	// changes are applied to a copy and only stored once they validate
+	b := *(*app.db)[idx]
+	b.Fields = make(map[string]string, len(b.Fields))
+	for k, v := range (*app.db)[idx].Fields {
+		b.Fields[k] = v
+	}
+	// an empty field.<name> value removes the field
+	for k := range raw {
+		if v, ok := fields[k]; ok {
+			b.Fields[k] = v
+		} else {
+			delete(b.Fields, k)
+		}
+		updated = true
+	}
+	if len(b.Fields) == 0 {
+		b.Fields = nil
+	}
+	// env.<name> sets the URL of an environment, an empty value removes it
+	envs := envValues(r.Form)
+	if len(envs) > 0 {
+		b.Envs = make(map[string]string, len(b.Envs)+len(envs))
+		for k, v := range (*app.db)[idx].Envs {
+			b.Envs[k] = v
+		}
+		for k, v := range envs {
+			if v == "" {
+				delete(b.Envs, k)
+			} else {
+				b.Envs[k] = v
+			}
+		}
+		if len(b.Envs) == 0 {
+			b.Envs = nil
+		}
+		updated = true
+	}
 	for _, param := range paramsExpected {
 		if r.FormValue(param) == "" {
 			continue
@@ -232,15 +458,62 @@ func (app *application) Update(w http.ResponseWriter, r *http.Request) {
 		updated = true
 		switch param {
 		case "name":
-			(*app.db)[idx].Name = r.FormValue(param)
+			b.Name = r.FormValue(param)
 		case "url":
-			(*app.db)[idx].URL = r.FormValue(param)
+			b.URL = r.FormValue(param)
+			b.Alias = ""
+		case "alias":
+			b.Alias = r.FormValue(param)
+			b.URL = ""
+			b.Envs = nil
 		case "tags":
-			(*app.db)[idx].Tags = strings.Split(r.FormValue(param), ",")
+			b.Tags = strings.Split(r.FormValue(param), ",")
+		case "visibility":
+			b.Visibility = r.FormValue(param)
+		case "title":
+			b.Title = r.FormValue(param)
+		case "notes":
+			b.Notes = r.FormValue(param)
+		case "password":
+			errs.add(param, b.SetPassword(r.FormValue(param)))
+		case "remove_password":
+			remove, err := strconv.ParseBool(r.FormValue(param))
+			if err != nil {
+				errs.add(param, FieldError{param, r.FormValue(param) + " is not a boolean"})
+			} else if remove {
+				b.SetPassword("")
+			}
+		case "max_clicks":
+			// a new limit restarts the count; 0 removes it
+			left, err := parseMaxClicks(r.FormValue(param))
+			errs.add(param, err)
+			b.ClicksLeft = left
+		}
+	}
+	errs.add("", b.Normalize())
+	if other, ok := nameIndex[b.Name]; ok && other != (*app.db)[idx] {
+		errs.add("name", FieldError{"name", b.Name + " already exists"})
+	}
+	if b.IsAlias() && len(errs) == 0 {
+		// checked against the current name, so chains through it are caught
+		if err := checkAlias(name, b.Alias); err != nil {
+			errs.add("alias", err)
+		} else if b.Alias == b.Name {
+			errs.add("alias", FieldError{"alias", "alias would form a cycle"})
 		}
 	}
+	if len(errs) > 0 {
+		badRequest(w, errs)
+		return
+	}
 	if updated {
+		*(*app.db)[idx] = b
+		if b.Name != name {
+			app.db.retarget(name, b.Name)
+			app.stats.rename(name, b.Name)
+		}
 		app.db.rebuildIndex()
+		searchIndex.add((*app.db)[idx])
 		app.Save()
 		fmt.Fprintf(w, "Updated")
 		return
@@ -248,6 +521,83 @@ func (app *application) Update(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "No change")
 }
 
+// setStatus changes the reading-list state and/or pinned flag of a bookmark.
+func (app *application) setStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "invalid method", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/status/")
+	if name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+	b, ok := nameIndex[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s: Not Found", name), http.StatusNotFound)
+		return
+	}
+	status := r.FormValue("status")
+	if status != "" && !ValidStatus(status) {
+		badRequest(w, FieldError{"status", status + " is not a valid status"})
+		return
+	}
+	pinned := r.FormValue("pinned")
+	if status == "" && pinned == "" {
+		fmt.Fprintf(w, "No change")
+		return
+	}
+	if pinned != "" {
+		p, err := strconv.ParseBool(pinned)
+		if err != nil {
+			badRequest(w, FieldError{"pinned", pinned + " is not a boolean"})
+			return
+		}
+		b.Pinned = p
+	}
+	if status != "" {
+		b.Status = status
+	}
+	app.infoLog.Printf("status: %s, %s pinned=%t\n", name, b.State(), b.Pinned)
+	app.Save()
+	fmt.Fprintf(w, "Updated")
+}
+
+// duplicates lists clusters of bookmarks sharing a canonical URL.
+func (app *application) duplicates(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(app.db.Duplicates()); err != nil {
+		app.errorLog.Printf("encoding error: %s\n", err.Error())
+	}
+}
+
+// dedupe merges duplicate clusters, or only the one for url when given, and
+// returns the surviving bookmarks.
+func (app *application) dedupe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "incorrect method", http.StatusMethodNotAllowed)
+		return
+	}
+	only := r.FormValue("url")
+	merged := make([]*Bookmark, 0)
+	for _, cluster := range app.db.Duplicates() {
+		if only != "" && Canonical(only) != Canonical(cluster[0].URL) {
+			continue
+		}
+		b := app.db.Merge(cluster)
+		for _, dup := range cluster {
+			app.stats.rename(dup.Name, b.Name)
+		}
+		app.infoLog.Printf("merged %d entries into %s\n", len(cluster), b.Name)
+		merged = append(merged, b)
+	}
+	if len(merged) > 0 {
+		app.Save()
+	}
+	json.NewEncoder(w).Encode(app.listable(r, merged))
+}
+
 func (app *application) Delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "invalid method", http.StatusBadRequest)
@@ -258,8 +608,26 @@ func (app *application) Delete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing name", http.StatusBadRequest)
 		return
 	}
+	aliases := app.db.aliasesOf(name)
 	if app.db.DeleteBookmark(name) == nil {
+		app.stats.remove(name)
 		fmt.Fprintf(w, "%s deleted", name)
+		names := make([]string, 0, len(aliases))
+		for _, a := range aliases {
+			names = append(names, a.Name)
+		}
+		if r.URL.Query().Get("cascade") == "1" {
+			for _, a := range names {
+				app.db.DeleteBookmark(a)
+				app.stats.remove(a)
+			}
+			if len(names) > 0 {
+				fmt.Fprintf(w, " with aliases %s", strings.Join(names, ", "))
+			}
+		} else if len(names) > 0 {
+			app.infoLog.Printf("%s deleted, aliases %s dangle\n", name, strings.Join(names, ", "))
+			fmt.Fprintf(w, " (warning: aliases %s no longer resolve)", strings.Join(names, ", "))
+		}
 		// persist data immediately
 		app.Save()
 	} else {
@@ -294,10 +662,26 @@ func (app *application) Save() error {
 	stat.WriteString(fmt.Sprintf(
 		"last_saved=%d\nsave_count=%d\nsize=%d\n",
 		time.Now().Unix(), app.numSaved, app.db.Size()))
-	return nil
+	if err := app.savePasswords(); err != nil {
+		return err
+	}
+	return app.saveStats()
+}
+
+// Sweep archives expired bookmarks and persists the result if anything
+// changed, and rolls up aged click stats.
+func (app *application) Sweep() {
+	app.stats.rollup(time.Now().Unix())
+	if n := app.db.Sweep(time.Now().Unix()); n > 0 {
+		app.infoLog.Printf("archived %d expired bookmarks\n", n)
+		app.Save()
+	}
 }
 
 func (app *application) Load() {
+	app.loadSchema()
+	app.loadSmart()
+	app.loadStats()
 	file, err := os.Open("db.dump")
 	if err != nil {
 		app.errorLog.Println(err)
@@ -313,6 +697,8 @@ func (app *application) Load() {
 	app.infoLog.Println("successfully loaded data from persistent store")
 	// rebuild various indices
 	app.db.rebuildIndex()
+	app.db.rebuildSearch()
+	app.loadPasswords()
 	app.infoLog.Println("successfully updated indices")
 }
 
@@ -3,8 +3,12 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/arbinish/go-bookmarks/bookmarks"
@@ -21,23 +25,48 @@ func newClient(url string, timeout int) *client {
 		url:     url,
 		timeout: timeout,
 		client: &http.Client{
-			Timeout: time.Duration(timeout) * time.Second,
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: bearer{os.Getenv("BOOKMARKS_TOKEN")},
 		},
 	}
 }
 
-func (c *client) delete(name string) bool {
+// bearer authenticates requests with the server's BOOKMARKS_TOKEN, if set.
+type bearer struct {
+	token string
+}
+
+func (b bearer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if b.token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// delete removes the bookmark name, and with cascade the aliases leading to
+// it. It returns the server's reply, which warns about dangling aliases.
+func (c *client) delete(name string, cascade bool) (string, bool) {
 	if c.findByParam("name", name) == nil {
 		fmt.Printf("%s: does not exist\n", name)
-		return false
+		return "", false
 	}
-	req, err := http.NewRequest(http.MethodDelete, c.url+"/api/v1/delete/"+name, nil)
+	_url := c.url + "/api/v1/delete/" + name
+	if cascade {
+		_url += "?cascade=1"
+	}
+	req, err := http.NewRequest(http.MethodDelete, _url, nil)
 	if err != nil {
 		fmt.Println("unable to init request", err)
-		return false
+		return "", false
 	}
-	_, err = c.client.Do(req)
-	return err == nil
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(resp.Body)
+	return string(msg), resp.StatusCode == http.StatusOK
 }
 
 func (c *client) dump() []*bookmarks.Bookmark {
@@ -57,35 +86,328 @@ func (c *client) dump() []*bookmarks.Bookmark {
 	return b
 }
 
-func (c *client) create(name, bookmarkURL, tags string) bool {
+// create adds a bookmark. extra carries optional parameters such as ttl or
+// custom field values.
+func (c *client) create(name, bookmarkURL, tags string, extra url.Values) bool {
 	_url := c.url + "/api/v1/create"
 	var params = make(url.Values)
 	params.Add("name", name)
 	params.Add("tags", tags)
 	params.Add("url", bookmarkURL)
+	for k, v := range extra {
+		params[k] = v
+	}
 	resp, err := c.client.PostForm(_url, params)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if err != nil {
 		return false
 	}
-	return true
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		printErrors(resp)
+	}
+	return resp.StatusCode == http.StatusOK
 }
 
-func (c *client) findByParam(param, value string) []*bookmarks.Bookmark {
-	url := fmt.Sprintf("%s%s?%s=%s", c.url, "/api/v1/find", param, value)
-	resp, err := c.client.Get(url)
+// printErrors prints the field errors of a rejected request.
+func printErrors(resp *http.Response) {
+	var body struct {
+		Errors bookmarks.ValidationError `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return
+	}
+	for _, e := range body.Errors {
+		fmt.Println(e)
+	}
+}
+
+func (c *client) search(q string, limit int) []bookmarks.SearchResult {
+	params := url.Values{"q": []string{q}, "limit": []string{fmt.Sprint(limit)}}
+	resp, err := c.client.Get(c.url + "/api/v1/search?" + params.Encode())
 	if err != nil {
 		fmt.Println(err)
 		return nil
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusNotFound {
+	if resp.StatusCode != http.StatusOK {
+		printErrors(resp)
 		return nil
 	}
-	dec := json.NewDecoder(resp.Body)
+	var r = make([]bookmarks.SearchResult, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil
+	}
+	return r
+}
+
+func (c *client) complete(prefix, kind string) []bookmarks.Completion {
+	params := url.Values{"prefix": []string{prefix}, "kind": []string{kind}}
+	resp, err := c.client.Get(c.url + "/api/v1/complete?" + params.Encode())
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var r = make([]bookmarks.Completion, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil
+	}
+	return r
+}
+
+func (c *client) duplicates() [][]*bookmarks.Bookmark {
+	resp, err := c.client.Get(c.url + "/api/v1/duplicates")
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	var b = make([][]*bookmarks.Bookmark, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil
+	}
+	return b
+}
+
+func (c *client) dedupe() []*bookmarks.Bookmark {
+	resp, err := c.client.PostForm(c.url+"/api/v1/dedupe", nil)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	defer resp.Body.Close()
 	var b = make([]*bookmarks.Bookmark, 0)
-	if err = dec.Decode(&b); err != nil {
+	if err = json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil
+	}
+	return b
+}
+
+// fieldParams converts key=value pairs into field.<key> parameters.
+func fieldParams(params url.Values, pairs []string) error {
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("%s: expected key=value", p)
+		}
+		params.Set("field."+kv[0], kv[1])
+	}
+	return nil
+}
+
+// envParams adds env=url pairs to params as env.<name> parameters.
+func envParams(params url.Values, pairs []string) error {
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("%s: expected env=url", p)
+		}
+		params.Set("env."+kv[0], kv[1])
+	}
+	return nil
+}
+
+func (c *client) setStatus(name, status, pinned string) bool {
+	var params = make(url.Values)
+	if status != "" {
+		params.Add("status", status)
+	}
+	if pinned != "" {
+		params.Add("pinned", pinned)
+	}
+	req, err := http.NewRequest(http.MethodPut, c.url+"/api/v1/status/"+name, strings.NewReader(params.Encode()))
+	if err != nil {
+		fmt.Println("unable to init request", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (c *client) smartCollections() []bookmarks.SmartCollection {
+	resp, err := c.client.Get(c.url + "/api/v1/smart")
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	var r = make([]bookmarks.SmartCollection, 0)
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil
+	}
+	return r
+}
+
+func (c *client) saveSmart(name string, params url.Values) bool {
+	form := url.Values{"name": []string{name}, "params": []string{params.Encode()}}
+	resp, err := c.client.PostForm(c.url+"/api/v1/smart", form)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		printErrors(resp)
+	}
+	return resp.StatusCode == http.StatusOK
+}
+
+func (c *client) deleteSmart(name string) bool {
+	req, err := http.NewRequest(http.MethodDelete, c.url+"/api/v1/smart/"+url.PathEscape(name), nil)
+	if err != nil {
+		fmt.Println("unable to init request", err)
+		return false
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// preview returns the URL the go-link name expands to for args.
+func (c *client) preview(name string, args []string, env string) (string, error) {
+	path := url.PathEscape(name)
+	for _, a := range args {
+		path += "/" + url.PathEscape(a)
+	}
+	if env != "" {
+		path += "?" + url.Values{"env": []string{env}}.Encode()
+	}
+	resp, err := c.client.Get(c.url + "/api/v1/preview/" + path)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Errors bookmarks.ValidationError `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && len(body.Errors) > 0 {
+			return "", body.Errors
+		}
+		return "", fmt.Errorf("%s: %s", name, resp.Status)
+	}
+	var r struct {
+		URL string
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", err
+	}
+	return r.URL, nil
+}
+
+func (c *client) shorten(target, password string, maxClicks int) *bookmarks.ShortLink {
+	params := url.Values{"url": []string{target}}
+	if password != "" {
+		params.Set("password", password)
+	}
+	if maxClicks > 0 {
+		params.Set("max_clicks", strconv.Itoa(maxClicks))
+	}
+	resp, err := c.client.PostForm(c.url+"/api/v1/shorten", params)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		printErrors(resp)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil
+	}
+	var link bookmarks.ShortLink
+	if err = json.NewDecoder(resp.Body).Decode(&link); err != nil {
 		fmt.Println("decoding failed", err)
 		return nil
 	}
+	return &link
+}
+
+func (c *client) stats(name, host string, days int) *bookmarks.ClickStats {
+	params := url.Values{"days": []string{strconv.Itoa(days)}}
+	if host != "" {
+		params.Set("host", host)
+	}
+	resp, err := c.client.Get(c.url + "/api/v1/stats/" + url.PathEscape(name) + "?" + params.Encode())
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusBadRequest {
+		printErrors(resp)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var stats bookmarks.ClickStats
+	if err = json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil
+	}
+	return &stats
+}
+
+func (c *client) findByParam(param, value string) []*bookmarks.Bookmark {
+	return c.find(url.Values{param: []string{value}})
+}
+
+func (c *client) find(params url.Values) []*bookmarks.Bookmark {
+	b, _, _ := c.lookup(params)
 	return b
 }
+
+// lookup queries /api/v1/find. When nothing matches, it returns the names
+// the server suggests instead. next is the cursor of the following page.
+func (c *client) lookup(params url.Values) (b []*bookmarks.Bookmark, suggestions []string, next string) {
+	return c.list("/api/v1/find", params)
+}
+
+// smart evaluates the smart collection name.
+func (c *client) smart(name string, params url.Values) (b []*bookmarks.Bookmark, next string) {
+	b, _, next = c.list("/api/v1/smart/"+url.PathEscape(name), params)
+	return b, next
+}
+
+func (c *client) list(path string, params url.Values) (b []*bookmarks.Bookmark, suggestions []string, next string) {
+	url := fmt.Sprintf("%s%s?%s", c.url, path, params.Encode())
+	resp, err := c.client.Get(url)
+	if err != nil {
+		fmt.Println(err)
+		return nil, nil, ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		var miss struct {
+			Suggestions []string `json:"suggestions"`
+		}
+		json.NewDecoder(resp.Body).Decode(&miss)
+		return nil, miss.Suggestions, ""
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		printErrors(resp)
+		return nil, nil, ""
+	}
+	dec := json.NewDecoder(resp.Body)
+	b = make([]*bookmarks.Bookmark, 0)
+	if err = dec.Decode(&b); err != nil {
+		fmt.Println("decoding failed", err)
+		return nil, nil, ""
+	}
+	return b, nil, resp.Header.Get("X-Next-Cursor")
+}
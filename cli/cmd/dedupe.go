@@ -0,0 +1,48 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// dedupeCmd represents the dedupe command
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Find and merge duplicate bookmarks",
+	Long: `
+	Lists clusters of bookmarks pointing at the same canonical URL and merges
+	each cluster into its oldest entry, combining tags and summing views.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		client := newClient("http://localhost:4912", 5)
+		clusters := client.duplicates()
+		if len(clusters) == 0 {
+			fmt.Println("no duplicates found")
+			return
+		}
+		for i, c := range clusters {
+			fmt.Printf("%d| %s\n", i+1, c[0].URL)
+			for _, b := range c {
+				fmt.Printf("\t%s\n", b)
+			}
+		}
+		if dryRun {
+			return
+		}
+		for _, b := range client.dedupe() {
+			fmt.Printf("merged into %s\n", b)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+
+	dedupeCmd.PersistentFlags().Bool("dry-run", false, "only list duplicate clusters, do not merge them.")
+}
@@ -19,8 +19,9 @@ var deleteCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		client := newClient("http://localhost:4912", 5)
 		name := cmd.Flag("name").Value.String()
-		if client.delete(name) {
-			fmt.Println("deleted")
+		cascade, _ := cmd.Flags().GetBool("cascade")
+		if msg, ok := client.delete(name, cascade); ok {
+			fmt.Println(msg)
 			return
 		}
 		fmt.Printf("%s: failed to delete\n", name)
@@ -36,6 +37,7 @@ func init() {
 	// and all subcommands, e.g.:
 	// deleteCmd.PersistentFlags().String("foo", "", "A help for foo")
 	deleteCmd.PersistentFlags().String("name", "", "bookmark name to delete")
+	deleteCmd.PersistentFlags().Bool("cascade", false, "also delete the aliases of the bookmark")
 
 	deleteCmd.MarkPersistentFlagRequired("name")
 
@@ -7,51 +7,146 @@ Copyright © 2022 NAME HERE <EMAIL ADDRESS>
 
 import (
 	"fmt"
+	"net/url"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/arbinish/go-bookmarks/bookmarks"
 	"github.com/spf13/cobra"
 )
 
+// completeFrom returns a shell completion function suggesting names or tags
+// known to the server.
+func completeFrom(kind string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		client := newClient("http://localhost:4912", 1)
+		var r []string
+		for _, c := range client.complete(toComplete, kind) {
+			r = append(r, c.Value)
+		}
+		return r, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// rangeFlags are passed on to find as the filter parameter of the same name,
+// with dashes replaced by underscores.
+var rangeFlags = []string{"created-after", "created-before", "accessed-after", "accessed-before", "views-min", "views-max", "name-re", "url-re"}
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [args...]",
 	Short: "List bookmark by name",
 	Long: `
-	List bookmarks by name or tags.
+	List bookmarks by name or tags. With --open, args fill in the
+	placeholders of template bookmarks, e.g. 'list --name jira --open OPS-123',
+	and --env picks the url of an environment, e.g.
+	'list --name grafana --env prod --open'.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		name := cmd.Flag("name").Value.String()
 		tag := cmd.Flag("tag").Value.String()
+		query := cmd.Flag("query").Value.String()
+		status := cmd.Flag("status").Value.String()
+		pinned := cmd.Flag("pinned").Value.String()
 		open := cmd.Flag("open").Value.String()
+		smart := cmd.Flag("smart").Value.String()
+		env := cmd.Flag("env").Value.String()
 		var urls = []string{}
 		var err error
 		var openCmd string
 
 		client := newClient("http://localhost:4912", 5)
-		if name == "" && tag == "" {
+		var param string
+		var params = make(url.Values)
+		for _, f := range rangeFlags {
+			if v, _ := cmd.Flags().GetString(f); v != "" {
+				params.Set(strings.ReplaceAll(f, "-", "_"), v)
+				param = f + " " + v
+			}
+		}
+		if name == "" && tag == "" && query == "" && status == "" && smart == "" && len(params) == 0 && !cmd.Flag("pinned").Changed && !cmd.Flag("field").Changed {
 			fmt.Println(cmd.UsageString())
 			return
 		}
-		var r []*bookmarks.Bookmark
-		var param string
 		if name != "" {
-			r = client.findByParam("name", name)
+			params.Set("name", name)
 			param = name
 		}
 		if tag != "" {
-			r = client.findByParam("tag", tag)
+			params.Set("tag", tag)
 			param = tag
 		}
+		if query != "" {
+			params.Set("q", query)
+			param = query
+		}
+		if status != "" {
+			params.Set("status", status)
+			if param == "" {
+				param = status
+			}
+		}
+		if cmd.Flag("pinned").Changed {
+			params.Set("pinned", pinned)
+			if param == "" {
+				param = "pinned"
+			}
+		}
+		fields, _ := cmd.Flags().GetStringArray("field")
+		if err = fieldParams(params, fields); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if param == "" && len(fields) > 0 {
+			param = strings.Join(fields, ",")
+		}
+		if fuzzy, _ := cmd.Flags().GetBool("fuzzy"); fuzzy && name != "" {
+			params.Set("fuzzy", "1")
+		}
+		if order, _ := cmd.Flags().GetString("sort"); order != "" {
+			params.Set("sort", order)
+		}
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 {
+			params.Set("limit", strconv.Itoa(limit))
+		}
+		if cursor, _ := cmd.Flags().GetString("cursor"); cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		var r []*bookmarks.Bookmark
+		var suggestions []string
+		var next string
+		if smart != "" {
+			r, next = client.smart(smart, params)
+			param = smart
+		} else {
+			r, suggestions, next = client.lookup(params)
+		}
 		if r == nil {
 			fmt.Printf("%s: not found\n", param)
+			if len(suggestions) > 0 {
+				fmt.Printf("did you mean: %s?\n", strings.Join(suggestions, ", "))
+			}
 			return
 		}
 		for i, p := range r {
 			fmt.Printf("%d| %s\n", i+1, p)
+			// templates, arguments and environments are expanded by the server
+			if p.Alias != "" || bookmarks.IsTemplate(p.URL) || len(args) > 0 || (env != "" && len(p.Envs) > 0) {
+				target, err := client.preview(p.Name, args, env)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				urls = append(urls, target)
+				continue
+			}
 			urls = append(urls, p.URL)
 		}
+		if next != "" {
+			fmt.Printf("more results: --cursor %s\n", next)
+		}
 		if open == "false" {
 			return
 		}
@@ -89,5 +184,25 @@ func init() {
 	// listCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	listCmd.PersistentFlags().String("name", "", "short name to look up.")
 	listCmd.PersistentFlags().String("tag", "", "tag to search for.")
+	listCmd.PersistentFlags().String("query", "", "boolean query, e.g. 'tag:go AND (tag:video OR tag:talk) NOT tag:old'.")
+	listCmd.PersistentFlags().String("status", "", "reading-list status to filter by: unread, reading, done or archived.")
+	listCmd.PersistentFlags().StringArray("field", nil, "custom field to match as key=value, may be repeated.")
+	listCmd.PersistentFlags().Bool("pinned", false, "only list pinned bookmarks.")
+	listCmd.PersistentFlags().Bool("fuzzy", false, "match names approximately, best matches first.")
+	listCmd.PersistentFlags().String("sort", "", "order of the results: name, created, accessed or views, prefixed with - to reverse, or frecency for the most used recently first.")
+	listCmd.PersistentFlags().String("created-after", "", "only bookmarks added since, e.g. -7d or 2022-01-31.")
+	listCmd.PersistentFlags().String("created-before", "", "only bookmarks added before, e.g. -7d or 2022-01-31.")
+	listCmd.PersistentFlags().String("accessed-after", "", "only bookmarks opened since, e.g. -7d or 2022-01-31.")
+	listCmd.PersistentFlags().String("accessed-before", "", "only bookmarks last opened before, e.g. -30d.")
+	listCmd.PersistentFlags().String("views-min", "", "only bookmarks opened at least this many times.")
+	listCmd.PersistentFlags().String("views-max", "", "only bookmarks opened at most this many times.")
+	listCmd.PersistentFlags().String("name-re", "", "regular expression the name must match.")
+	listCmd.PersistentFlags().String("url-re", "", "regular expression the url must match, e.g. '\\.corp\\.example\\.com'.")
+	listCmd.PersistentFlags().String("smart", "", "list the bookmarks of a saved smart collection.")
+	listCmd.PersistentFlags().Int("limit", 0, "number of results per page.")
+	listCmd.PersistentFlags().String("cursor", "", "continue after the page that printed this cursor.")
+	listCmd.RegisterFlagCompletionFunc("name", completeFrom(bookmarks.KindName))
+	listCmd.RegisterFlagCompletionFunc("tag", completeFrom(bookmarks.KindTag))
+	listCmd.PersistentFlags().String("env", "", "environment whose url to use, for bookmarks with per-environment urls.")
 	listCmd.PersistentFlags().Bool("open", false, "open url in default browser. default: false, do not open url in browser.")
 }
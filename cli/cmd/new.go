@@ -7,7 +7,12 @@ Copyright © 2022 NAME HERE <EMAIL ADDRESS>
 
 import (
 	"fmt"
+	neturl "net/url"
+	"os/user"
+	"strconv"
+	"strings"
 
+	"github.com/arbinish/go-bookmarks/bookmarks"
 	"github.com/spf13/cobra"
 )
 
@@ -16,13 +21,58 @@ var newCmd = &cobra.Command{
 	Use:   "new",
 	Short: "Create a new bookmark",
 	Long: `
-	Create a new bookmark entry. Expects a name, url, and tags for quick search. `,
+	Create a new bookmark entry. Expects a name, url, and tags for quick search.
+	With --alias, the new name refers to an existing bookmark instead of a url. `,
 	Run: func(cmd *cobra.Command, args []string) {
 		name := cmd.Flag("name").Value.String()
 		tags := cmd.Flag("tags").Value.String()
 		url := cmd.Flag("url").Value.String()
+		expires := cmd.Flag("expires").Value.String()
+		var extra = make(neturl.Values)
+		if expires != "" {
+			if _, err := bookmarks.ParseTTL(expires); err != nil {
+				fmt.Println(err)
+				return
+			}
+			extra.Set("ttl", expires)
+		}
+		for _, f := range []string{"title", "notes", "password"} {
+			if v := cmd.Flag(f).Value.String(); v != "" {
+				extra.Set(f, v)
+			}
+		}
+		if n, _ := cmd.Flags().GetInt("max-clicks"); n > 0 {
+			extra.Set("max_clicks", strconv.Itoa(n))
+		}
+		if u, err := user.Current(); err == nil {
+			extra.Set("creator", u.Username)
+		}
+		if visibility := cmd.Flag("visibility").Value.String(); visibility != "" {
+			extra.Set("visibility", visibility)
+		}
+		envs, _ := cmd.Flags().GetStringArray("env-url")
+		if err := envParams(extra, envs); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fields, _ := cmd.Flags().GetStringArray("field")
+		if err := fieldParams(extra, fields); err != nil {
+			fmt.Println(err)
+			return
+		}
+		bk := bookmarks.NewBookmark(name, url, strings.Split(tags, ","))
+		if alias := cmd.Flag("alias").Value.String(); alias != "" {
+			bk.Alias = alias
+			extra.Set("alias", alias)
+		}
+		if err := bk.Normalize(); err != nil {
+			for _, e := range err.(bookmarks.ValidationError) {
+				fmt.Println(e)
+			}
+			return
+		}
 		client := newClient("http://localhost:4912", 5)
-		if client.create(name, url, tags) {
+		if client.create(bk.Name, bk.URL, strings.Join(bk.Tags, ","), extra) {
 			fmt.Println("created")
 			return
 		}
@@ -35,9 +85,17 @@ func init() {
 
 	// Here you will define your flags and configuration settings.
 	newCmd.PersistentFlags().String("url", "", "URL to save")
+	newCmd.PersistentFlags().String("alias", "", "Name of an existing bookmark this one stands for, instead of a URL")
 	newCmd.PersistentFlags().String("tags", "", "A comma separated list of tags for the given URL")
 	newCmd.PersistentFlags().String("name", "", "A short name to refer the bookmark")
-	newCmd.MarkPersistentFlagRequired("url")
+	newCmd.PersistentFlags().StringArray("env-url", nil, "URL of an environment as env=url, may be repeated; --url is the default")
+	newCmd.PersistentFlags().StringArray("field", nil, "Custom field value as key=value, may be repeated")
+	newCmd.PersistentFlags().String("title", "", "Title of the linked page")
+	newCmd.PersistentFlags().String("notes", "", "Free form notes, included in full-text search")
+	newCmd.PersistentFlags().String("visibility", "", "Who can see the bookmark: private, unlisted or public. default: private")
+	newCmd.PersistentFlags().String("expires", "", "Lifetime of the bookmark, e.g. 7d or 12h. default: never expires")
+	newCmd.PersistentFlags().String("password", "", "Password asked for before redirecting")
+	newCmd.PersistentFlags().Int("max-clicks", 0, "Number of redirects after which the link is used up. default: unlimited")
 	newCmd.MarkPersistentFlagRequired("tags")
 	newCmd.MarkPersistentFlagRequired("name")
 
@@ -0,0 +1,44 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/arbinish/go-bookmarks/bookmarks"
+	"github.com/spf13/cobra"
+)
+
+// queueCmd represents the queue command
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Show the unread reading queue",
+	Long: `
+	Lists unread bookmarks, pinned entries first and then oldest first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := newClient("http://localhost:4912", 5)
+		r := client.find(url.Values{"status": []string{bookmarks.StatusUnread}})
+		if len(r) == 0 {
+			fmt.Println("reading queue is empty")
+			return
+		}
+		sort.Slice(r, func(i, j int) bool {
+			if r[i].Pinned != r[j].Pinned {
+				return r[i].Pinned
+			}
+			return r[i].Created < r[j].Created
+		})
+		for i, p := range r {
+			fmt.Printf("%d| %s\n", i+1, p)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+
+	"github.com/arbinish/go-bookmarks/bookmarks"
+	"github.com/spf13/cobra"
+)
+
+// readCmd represents the read command
+var readCmd = &cobra.Command{
+	Use:   "read <name>",
+	Short: "Mark a bookmark as read",
+	Long: `
+	Moves a bookmark out of the reading queue by marking it done. Use --status
+	to record a different state, e.g. reading.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		status := cmd.Flag("status").Value.String()
+		if !bookmarks.ValidStatus(status) {
+			fmt.Printf("%s: invalid status\n", status)
+			return
+		}
+		client := newClient("http://localhost:4912", 5)
+		if client.setStatus(name, status, "") {
+			fmt.Printf("%s: %s\n", name, status)
+			return
+		}
+		fmt.Printf("%s: failed to update status\n", name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(readCmd)
+
+	readCmd.PersistentFlags().String("status", bookmarks.StatusDone, "status to record: unread, reading, done or archived.")
+}
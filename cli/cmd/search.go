@@ -0,0 +1,43 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Full-text search over bookmarks",
+	Long: `
+	Searches names, titles, urls, tags and notes, best matches first.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+		client := newClient("http://localhost:4912", 5)
+		r := client.search(strings.Join(args, " "), limit)
+		if len(r) == 0 {
+			fmt.Println("no matches")
+			return
+		}
+		for i, p := range r {
+			fmt.Printf("%d| %s | %.2f\n", i+1, p.Bookmark, p.Score)
+			if p.Snippet != "" {
+				fmt.Printf("\t%s\n", p.Snippet)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.PersistentFlags().Int("limit", 10, "maximum number of results.")
+}
@@ -0,0 +1,43 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// shortenCmd represents the shorten command
+var shortenCmd = &cobra.Command{
+	Use:   "shorten <url>",
+	Short: "Print a short link for a url",
+	Long: `
+	Stores the url under a random short code, or reuses the name it is
+	already stored under, and prints the resulting short link. Links with
+	a password or click limit always get a new code.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := newClient("http://localhost:4912", 5)
+		password := cmd.Flag("password").Value.String()
+		maxClicks, _ := cmd.Flags().GetInt("max-clicks")
+		link := client.shorten(args[0], password, maxClicks)
+		if link == nil {
+			fmt.Printf("failed to shorten %s\n", args[0])
+			return
+		}
+		fmt.Println(link.Short)
+		if link.ClicksLeft != nil {
+			fmt.Printf("clicks left: %d\n", *link.ClicksLeft)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shortenCmd)
+	shortenCmd.Flags().String("password", "", "Password asked for before redirecting")
+	shortenCmd.Flags().Int("max-clicks", 0, "Number of redirects after which the link is used up. default: unlimited")
+}
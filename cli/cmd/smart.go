@@ -0,0 +1,74 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// smartCmd represents the smart command
+var smartCmd = &cobra.Command{
+	Use:   "smart [name]",
+	Short: "Manage saved smart collections",
+	Long: `
+	Without arguments, lists the saved smart collections. With a name, saves
+	the lookup given by the flags under that name, or removes it with --delete.
+	Use 'list --smart <name>' to list the bookmarks of a collection.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := newClient("http://localhost:4912", 5)
+		if len(args) == 0 {
+			for i, s := range client.smartCollections() {
+				fmt.Printf("%d| %s | %s\n", i+1, s.Name, s.Params)
+			}
+			return
+		}
+		name := args[0]
+		if del, _ := cmd.Flags().GetBool("delete"); del {
+			if !client.deleteSmart(name) {
+				fmt.Printf("failed to delete %s\n", name)
+				return
+			}
+			fmt.Printf("%s deleted\n", name)
+			return
+		}
+		params := make(url.Values)
+		// flag name to find parameter
+		for flag, param := range map[string]string{"query": "q", "tag": "tag", "status": "status", "sort": "sort"} {
+			if v, _ := cmd.Flags().GetString(flag); v != "" {
+				params.Set(param, v)
+			}
+		}
+		if cmd.Flag("pinned").Changed {
+			params.Set("pinned", cmd.Flag("pinned").Value.String())
+		}
+		fields, _ := cmd.Flags().GetStringArray("field")
+		if err := fieldParams(params, fields); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !client.saveSmart(name, params) {
+			fmt.Printf("failed to save %s\n", name)
+			return
+		}
+		fmt.Printf("saved %s\n", name)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(smartCmd)
+
+	smartCmd.PersistentFlags().String("query", "", "boolean query, e.g. 'tag:golang status:unread'.")
+	smartCmd.PersistentFlags().String("tag", "", "tags to match, comma separated.")
+	smartCmd.PersistentFlags().String("status", "", "reading-list status to match.")
+	smartCmd.PersistentFlags().Bool("pinned", false, "only match pinned bookmarks.")
+	smartCmd.PersistentFlags().StringArray("field", nil, "custom field to match as key=value, may be repeated.")
+	smartCmd.PersistentFlags().String("sort", "", "order of the results.")
+	smartCmd.PersistentFlags().Bool("delete", false, "remove the smart collection.")
+}
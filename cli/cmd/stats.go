@@ -0,0 +1,52 @@
+package cmd
+
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+
+*/
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats <name>",
+	Short: "Show redirect clicks of a bookmark",
+	Long: `
+	Prints the clicks through /go/<name> per day, followed by the top
+	referrers and browser families. --host only counts the clicks made
+	through one host name.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		days, _ := cmd.Flags().GetInt("days")
+		host, _ := cmd.Flags().GetString("host")
+		client := newClient("http://localhost:4912", 5)
+		stats := client.stats(args[0], host, days)
+		if stats == nil {
+			fmt.Printf("no stats for %s\n", args[0])
+			return
+		}
+		fmt.Printf("%s: %d clicks\n", stats.Name, stats.Total)
+		for _, p := range stats.Daily {
+			if p.Clicks > 0 {
+				fmt.Printf("\t%s %d\n", time.Unix(p.Start, 0).UTC().Format("2006-01-02"), p.Clicks)
+			}
+		}
+		for _, c := range stats.Referrers {
+			fmt.Printf("referrer %s: %d\n", c.Key, c.Clicks)
+		}
+		for _, c := range stats.Agents {
+			fmt.Printf("agent %s: %d\n", c.Key, c.Clicks)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().Int("days", 30, "number of days to show")
+	statsCmd.Flags().String("host", "", "only count clicks made through this host name")
+}
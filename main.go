@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -18,6 +19,42 @@ func main() {
 
 	db := bookmarks.NewDB()
 	app := bookmarks.NewApp(infoLog, errLog, &db)
+	app.RequireToken(os.Getenv("BOOKMARKS_TOKEN"))
+	if v := os.Getenv("BOOKMARKS_TRUST_LOCAL"); v != "" {
+		trust, err := strconv.ParseBool(v)
+		if err != nil {
+			errLog.Fatalln("BOOKMARKS_TRUST_LOCAL:", err)
+		}
+		app.TrustLoopback(trust)
+	}
+	rules, err := bookmarks.ParseCanonRules(os.Getenv("BOOKMARKS_CANON_RULES"))
+	if err != nil {
+		errLog.Fatalln(err)
+	}
+	bookmarks.SetCanonRules(rules)
+	hosts, err := bookmarks.ParseHosts(os.Getenv("BOOKMARKS_HOSTS"))
+	if err != nil {
+		errLog.Fatalln("BOOKMARKS_HOSTS:", err)
+	}
+	app.SetHosts(hosts)
+	if n := os.Getenv("BOOKMARKS_CODE_LENGTH"); n != "" {
+		length, err := strconv.Atoi(n)
+		if err == nil {
+			err = bookmarks.SetCodeLength(length)
+		}
+		if err != nil {
+			errLog.Fatalln("BOOKMARKS_CODE_LENGTH:", err)
+		}
+	}
+	if d := os.Getenv("BOOKMARKS_STATS_ROLLUP"); d != "" {
+		period, err := time.ParseDuration(d)
+		if err == nil {
+			err = bookmarks.SetRollupAfter(period)
+		}
+		if err != nil {
+			errLog.Fatalln("BOOKMARKS_STATS_ROLLUP:", err)
+		}
+	}
 	app.Load()
 	infoLog.Println("db size", db.Size())
 	srv := &http.Server{
@@ -25,7 +62,18 @@ func main() {
 		ErrorLog: errLog,
 		Handler:  app.Routes(),
 	}
+	// BOOKMARKS_GO_ADDR optionally serves /{name} redirects on a listener
+	// of its own, e.g. behind a short host name
+	var goSrv *http.Server
+	if addr := os.Getenv("BOOKMARKS_GO_ADDR"); addr != "" {
+		goSrv = &http.Server{
+			Addr:     addr,
+			ErrorLog: errLog,
+			Handler:  app.GoRoutes(),
+		}
+	}
 	ticker := time.NewTicker(59 * time.Second)
+	sweeper := time.NewTicker(time.Minute)
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -36,6 +84,13 @@ func main() {
 		}
 	}()
 
+	go func() {
+		for {
+			<-sweeper.C
+			app.Sweep()
+		}
+	}()
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			errLog.Fatalln(err)
@@ -43,12 +98,25 @@ func main() {
 	}()
 
 	infoLog.Println("starting server on :4912")
+	if goSrv != nil {
+		go func() {
+			if err := goSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errLog.Fatalln(err)
+			}
+		}()
+		infoLog.Println("serving redirects on", goSrv.Addr)
+	}
 
 	<-done
 	infoLog.Println("server stopped.")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if goSrv != nil {
+		if err := goSrv.Shutdown(ctx); err != nil {
+			errLog.Printf("redirect server shutdown failed: %v\n", err)
+		}
+	}
 	if err := srv.Shutdown(ctx); err != nil {
 		errLog.Fatalf("server shutdown failed: %v\n", err)
 		return